@@ -0,0 +1,286 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// methodTable is the set of methods registered for a path, along with the
+// value of the Allow header for them, which is computed once here instead of
+// on every request. It is never modified, but replaced.
+type methodTable struct {
+	// methods are the registered methods, sorted
+	methods []string
+	// routes are the routes of the methods, in the same order, or nil for a
+	// table of the methods only
+	routes []methodRoute
+	// allowed are the methods other than OPTIONS and MethodAny, followed by
+	// OPTIONS, or nil if there are none
+	allowed []string
+	// allow holds the value of the Allow header, the allowed methods joined
+	allow []string
+	// headAllowed and headAllow are the allowed methods and the Allow header
+	// with HEAD added if GET is allowed, for Router.HandleHead
+	headAllowed []string
+	headAllow   []string
+}
+
+// methodRoute is the route of a method in a methodTable.
+type methodRoute struct {
+	handle Handle
+	// path is the path the route was registered with
+	path string
+	// keys are the names of the parameters of the path, which are renamed in
+	// the tree of the paths, see pathKey
+	keys []string
+}
+
+func newMethodTable(methods []string, routes []methodRoute) *methodTable {
+	if len(methods) == 0 {
+		return nil
+	}
+	t := &methodTable{methods: methods, routes: routes}
+	for _, method := range methods {
+		if method != "OPTIONS" && method != MethodAny {
+			t.allowed = append(t.allowed, method)
+		}
+	}
+	if len(t.allowed) > 0 {
+		t.allowed = append(t.allowed, "OPTIONS")
+		t.allow = []string{strings.Join(t.allowed, ", ")}
+	}
+
+	t.headAllowed, t.headAllow = t.allowed, t.allow
+	if t.has("GET") && !t.has("HEAD") {
+		methods := t.allowed[:len(t.allowed)-1]
+		i := sort.SearchStrings(methods, "HEAD")
+		t.headAllowed = make([]string, 0, len(t.allowed)+1)
+		t.headAllowed = append(t.headAllowed, methods[:i]...)
+		t.headAllowed = append(t.headAllowed, "HEAD")
+		t.headAllowed = append(t.headAllowed, t.allowed[i:]...)
+		t.headAllow = []string{strings.Join(t.headAllowed, ", ")}
+	}
+	return t
+}
+
+// index returns the position of the method in the table, which may be nil, or
+// -1.
+func (t *methodTable) index(method string) int {
+	if t == nil {
+		return -1
+	}
+	// there are only a few methods, which are faster to scan than to search
+	for i, m := range t.methods {
+		if m == method {
+			return i
+		}
+	}
+	return -1
+}
+
+// has reports whether the method is in the table, which may be nil.
+func (t *methodTable) has(method string) bool {
+	return t.index(method) >= 0
+}
+
+// route returns the route of the method, or nil.
+func (t *methodTable) route(method string) *methodRoute {
+	if i := t.index(method); i >= 0 {
+		return &t.routes[i]
+	}
+	return nil
+}
+
+// with returns the table of routes with the route of the method added, which
+// must not be in it yet. t may be nil.
+func (t *methodTable) with(method string, rt methodRoute) *methodTable {
+	var methods []string
+	var routes []methodRoute
+	if t != nil {
+		methods = make([]string, 0, len(t.methods)+1)
+		routes = make([]methodRoute, 0, len(t.methods)+1)
+		methods = append(methods, t.methods...)
+		routes = append(routes, t.routes...)
+	}
+
+	i := sort.SearchStrings(methods, method)
+	methods = append(methods, "")
+	copy(methods[i+1:], methods[i:])
+	methods[i] = method
+	routes = append(routes, methodRoute{})
+	copy(routes[i+1:], routes[i:])
+	routes[i] = rt
+	return newMethodTable(methods, routes)
+}
+
+// without returns the table of routes with the route of the method removed,
+// or nil if it's empty then.
+func (t *methodTable) without(method string) *methodTable {
+	i := t.index(method)
+	if i < 0 {
+		return t
+	}
+	methods := make([]string, 0, len(t.methods)-1)
+	routes := make([]methodRoute, 0, len(t.methods)-1)
+	methods = append(append(methods, t.methods[:i]...), t.methods[i+1:]...)
+	routes = append(append(routes, t.routes[:i]...), t.routes[i+1:]...)
+	return newMethodTable(methods, routes)
+}
+
+// pathLeaf is the handle of the nodes holding methods in the tree of the
+// paths of all methods. It only marks them, and is never called.
+func pathLeaf(http.ResponseWriter, *http.Request, Params) error {
+	return nil
+}
+
+// pathKey returns the path under which a route is added to the tree of the
+// paths of all methods. The parameters are renamed, since their names don't
+// matter for matching, but routes of different methods may name them
+// differently, which would conflict in a single tree.
+func pathKey(path string) string {
+	buf := make([]byte, 0, len(path))
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		buf = append(buf, c)
+		if c != ':' && c != '*' {
+			continue
+		}
+
+		nameEnd, end := len(path), len(path)
+		if c == ':' {
+			nameEnd, end = wildcardEnd(path, i)
+		}
+		// keep the constraint, if any
+		buf = append(buf, 'p')
+		buf = append(buf, path[nameEnd:end]...)
+		i = end - 1
+	}
+	return string(buf)
+}
+
+// methodMatch collects the method tables of the leaves matching a path. In
+// the common case of a single leaf, it doesn't allocate.
+type methodMatch struct {
+	first *methodTable
+	more  []*methodTable
+	// walked is set by a lookup which walked all leaves matching the path
+	// without finding a route, see routes.lookupMatch
+	walked bool
+}
+
+// add adds the table t, which may be nil. m may be nil as well, as it is for
+// lookups which don't collect the methods.
+func (m *methodMatch) add(t *methodTable) {
+	switch {
+	case t == nil || m == nil || t == m.first:
+	case m.first == nil:
+		m.first = t
+	default:
+		m.more = append(m.more, t)
+	}
+}
+
+// table returns the table of the methods of all matching leaves, or nil.
+func (m *methodMatch) table() *methodTable {
+	if len(m.more) == 0 {
+		return m.first
+	}
+	methods := append([]string(nil), m.first.methods...)
+	for _, other := range m.more {
+		for _, method := range other.methods {
+			if i := sort.SearchStrings(methods, method); i == len(methods) || methods[i] != method {
+				methods = append(methods, "")
+				copy(methods[i+1:], methods[i:])
+				methods[i] = method
+			}
+		}
+	}
+	return newMethodTable(methods, nil)
+}
+
+// matchMethods adds the methods of every leaf below n matching the path to
+// m. Unlike a lookup, it doesn't stop at the first match. The path begins
+// with the path of n, or the value of the wildcard n.
+func (n *node) matchMethods(path string, m *methodMatch) {
+	switch n.nType {
+	case param:
+		end := 0
+		for end < len(path) && path[end] != '/' {
+			end++
+		}
+		if end == 0 || (n.constraint != nil && !n.constraint.match(path[:end])) {
+			return
+		}
+		path = path[end:]
+	case catchAll:
+		m.add(n.methods)
+		return
+	default:
+		if len(path) < len(n.path) || path[:len(n.path)] != n.path {
+			return
+		}
+		path = path[len(n.path):]
+	}
+
+	if len(path) == 0 {
+		m.add(n.methods)
+
+		// A catchAll child also matches the path segment root
+		if child := n.wildcardChild(catchAll); child != nil {
+			m.add(child.methods)
+		}
+		return
+	}
+
+	for i := 0; i < len(n.indices); i++ {
+		if path[0] == n.indices[i] {
+			n.children[i].matchMethods(path, m)
+			break
+		}
+	}
+	for _, child := range n.children[len(n.indices):] {
+		child.matchMethods(path, m)
+	}
+}
+
+// allowed returns the methods allowed for the path, or for the server if the
+// path is *, followed by OPTIONS, and the value of the Allow header for them.
+// If head is set, HEAD is allowed wherever GET is. Both are nil if there are
+// none. They are shared, and must not be modified, so the replies and errors
+// made from them get copies.
+//
+// The methods of a path are precomputed at registration, so unless the
+// routes of several paths match it, this takes a single lookup and doesn't
+// allocate.
+func (rs *routes) allowed(path string, head bool) (allowed, allow []string) {
+	return rs.matchAllowed(path, nil, head)
+}
+
+// matchAllowed is like allowed, but takes the methods from m, which may be
+// nil, if the lookup which filled it walked all leaves matching the path
+// already. Otherwise they are matched anew.
+func (rs *routes) matchAllowed(path string, m *methodMatch, head bool) (allowed, allow []string) {
+	t := rs.methods
+	if path != "*" {
+		if m == nil || !m.walked {
+			m = new(methodMatch)
+			if rs.paths != nil {
+				rs.paths.matchMethods(path, m)
+			}
+		}
+		t = m.table()
+	}
+	if t == nil {
+		return nil, nil
+	}
+	if head {
+		return t.headAllowed, t.headAllow
+	}
+	return t.allowed, t.allow
+}
@@ -0,0 +1,269 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestPathKey(t *testing.T) {
+	tests := []struct {
+		path, key string
+	}{
+		{"/", "/"},
+		{"/user/:name", "/user/:p"},
+		{"/user/:id<int>/posts/:post", "/user/:p<int>/posts/:p"},
+		{"/v:major/src/*filepath", "/v:p/src/*p"},
+		{"/date/:d<\\d{4}-\\d{2}>", "/date/:p<\\d{4}-\\d{2}>"},
+	}
+	for _, test := range tests {
+		if key := pathKey(test.path); key != test.key {
+			t.Errorf("wrong key for %s: want %s, got %s", test.path, test.key, key)
+		}
+	}
+}
+
+func TestRouterAllowed(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	for _, method := range [...]string{"PUT", "GET", "DELETE", "POST", "PATCH"} {
+		router.Handle(method, "/path", handle)
+	}
+	router.Get("/user/:name", handle)
+	router.Post("/user/new", handle)
+	router.Put("/user/:id<int>", handle)
+	router.Delete("/user/:id", handle)
+	router.Get("/src/*filepath", handle)
+	router.Delete("/src/a", handle)
+	router.Options("/opt", handle)
+
+	tests := []struct {
+		path  string
+		allow string
+	}{
+		{"/path", "DELETE, GET, PATCH, POST, PUT, OPTIONS"},
+		{"/user/new", "DELETE, GET, POST, OPTIONS"},
+		{"/user/42", "DELETE, GET, PUT, OPTIONS"},
+		{"/user/gopher", "DELETE, GET, OPTIONS"},
+		{"/src/", "GET, OPTIONS"},
+		{"/src/a", "DELETE, GET, OPTIONS"},
+		{"/src/a/b", "GET, OPTIONS"},
+		{"*", "DELETE, GET, PATCH, POST, PUT, OPTIONS"},
+		{"/opt", ""},
+		{"/nope", ""},
+	}
+	for _, test := range tests {
+		// repeated, since the order used to depend on the map iteration
+		for i := 0; i < 5; i++ {
+			allowed, allow := router.getRoutes().allowed(test.path, false)
+			if len(test.allow) == 0 {
+				if allowed != nil || allow != nil {
+					t.Errorf("methods allowed for %s: %v", test.path, allowed)
+				}
+				break
+			}
+			if len(allow) != 1 || allow[0] != test.allow {
+				t.Errorf("wrong Allow header for %s: want %q, got %q", test.path, test.allow, allow)
+				break
+			}
+		}
+	}
+
+	// HEAD is added where GET is allowed, for Router.HandleHead
+	for path, want := range map[string]string{
+		"/path":    "DELETE, GET, HEAD, PATCH, POST, PUT, OPTIONS",
+		"/user/42": "DELETE, GET, HEAD, PUT, OPTIONS",
+		"*":        "DELETE, GET, HEAD, PATCH, POST, PUT, OPTIONS",
+	} {
+		if _, allow := router.getRoutes().allowed(path, true); len(allow) != 1 || allow[0] != want {
+			t.Errorf("wrong Allow header for %s with HEAD: want %q, got %q", path, want, allow)
+		}
+	}
+
+	// removed routes are no longer allowed
+	router.Remove("DELETE", "/user/:id")
+	router.Remove("GET", "/src/*filepath")
+	for path, want := range map[string]string{
+		"/user/42": "GET, PUT, OPTIONS",
+		"/src/a":   "DELETE, OPTIONS",
+	} {
+		if _, allow := router.getRoutes().allowed(path, false); len(allow) != 1 || allow[0] != want {
+			t.Errorf("wrong Allow header for %s after removal: want %q, got %q", path, want, allow)
+		}
+	}
+	if _, allow := router.getRoutes().allowed("/src/", false); allow != nil {
+		t.Errorf("removed route still allowed: %q", allow)
+	}
+
+	// the routes can be served with the header set as well
+	r, _ := http.NewRequest("PATCH", "/user/new", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, POST, OPTIONS" {
+		t.Errorf("wrong 405 reply: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestRoutesLookupMatch(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.UnifiedTree = true
+	router.Get("/user/:name", handle)
+	router.Post("/user/new", handle)
+	router.Put("/user/:id<int>", handle)
+	router.Delete("/user/:id", handle)
+	router.Get("/src/*filepath", handle)
+	router.Delete("/src/a", handle)
+	router.Patch("/src/", handle)
+	router.Options("/opt", handle)
+	rs := router.getRoutes()
+
+	// the lookup which doesn't find a route collects the methods of all
+	// leaves matching the path, for methods without any route as well
+	for _, method := range [...]string{"HEAD", "PATCH", "TRACE"} {
+		for _, path := range [...]string{"/user/new", "/user/42", "/user/gopher", "/src/", "/src/a", "/src/a/b", "/opt", "/nope", "/src"} {
+			var m methodMatch
+			if h, _, _, _ := rs.lookupMatch(method, path, nil, &m); h != nil {
+				continue
+			}
+			if !m.walked {
+				t.Errorf("lookup of %s %s did not walk all leaves", method, path)
+			}
+			wantAllowed, want := rs.allowed(path, false)
+			gotAllowed, got := rs.matchAllowed(path, &m, false)
+			if !reflect.DeepEqual(wantAllowed, gotAllowed) || !reflect.DeepEqual(want, got) {
+				t.Errorf("wrong methods of %s %s: want %q, got %q", method, path, want, got)
+			}
+		}
+	}
+
+	// but not if a route is found
+	var m methodMatch
+	if h, _, _, _ := rs.lookupMatch("DELETE", "/src/a", nil, &m); h == nil || m.walked {
+		t.Errorf("wrong lookup of a route: %v %v", h != nil, m.walked)
+	}
+
+	// nor for the trees of the methods
+	router = New()
+	router.Get("/user/:name", handle)
+	m = methodMatch{}
+	if h, _, _, _ := router.getRoutes().lookupMatch("POST", "/user/gopher", nil, &m); h != nil || m.walked {
+		t.Errorf("wrong lookup in the trees: %v %v", h != nil, m.walked)
+	}
+}
+
+func TestRouterAllowedCopyOnWrite(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := NewConcurrent()
+	router.Get("/path", handle)
+	rs := router.getRoutes()
+	router.Post("/path", handle)
+	router.Put("/other", handle)
+
+	if _, allow := rs.allowed("/path", false); len(allow) != 1 || allow[0] != "GET, OPTIONS" {
+		t.Errorf("methods of the routes in use modified: %q", allow)
+	}
+	if _, allow := rs.allowed("*", false); len(allow) != 1 || allow[0] != "GET, OPTIONS" {
+		t.Errorf("methods of the server in use modified: %q", allow)
+	}
+	if _, allow := router.getRoutes().allowed("/path", false); len(allow) != 1 || allow[0] != "GET, POST, OPTIONS" {
+		t.Errorf("wrong Allow header: %q", allow)
+	}
+}
+
+func TestRouterAllowedAllocs(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.Get("/user/:name", handle)
+	router.Post("/user/:id", handle)
+	router.Put("/src/*filepath", handle)
+
+	rs := router.getRoutes()
+	allocs := testing.AllocsPerRun(100, func() {
+		rs.allowed("/user/gopher", false)
+		rs.allowed("/src/a/b", false)
+		rs.allowed("*", false)
+	})
+	if allocs > 0 {
+		t.Errorf("allowed methods allocated %v times", allocs)
+	}
+
+	router = New()
+	router.UnifiedTree = true
+	router.Get("/user/:name", handle)
+	router.Post("/user/:id", handle)
+	rs = router.getRoutes()
+	// the values are appended to p during the walk
+	p := make(Params, 0, 1)
+	allocs = testing.AllocsPerRun(100, func() {
+		var m methodMatch
+		rs.lookupMatch("PATCH", "/user/gopher", p, &m)
+		rs.matchAllowed("/user/gopher", &m, false)
+	})
+	if allocs > 0 {
+		t.Errorf("allowed methods of a unified lookup allocated %v times", allocs)
+	}
+}
+
+// headerWriter is a http.ResponseWriter reusing its header.
+type headerWriter struct {
+	header http.Header
+}
+
+func (w *headerWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *headerWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w *headerWriter) WriteHeader(int) {}
+
+func benchmarkAllowed(b *testing.B, methods int, reqMethod string) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	for i := 0; i < methods; i++ {
+		method := fmt.Sprintf("METHOD%02d", i)
+		router.Handle(method, "/user/:name", handle)
+		router.Handle(method, fmt.Sprintf("/static/%d", i), handle)
+		router.Handle(method, "/src/*filepath", handle)
+	}
+
+	r, _ := http.NewRequest(reqMethod, "/user/gopher", nil)
+	w := &headerWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkAllowed5(b *testing.B) {
+	benchmarkAllowed(b, 5, "GET")
+}
+
+func BenchmarkAllowed50(b *testing.B) {
+	benchmarkAllowed(b, 50, "GET")
+}
+
+func BenchmarkAllowedOptions5(b *testing.B) {
+	benchmarkAllowed(b, 5, "OPTIONS")
+}
+
+func BenchmarkAllowedOptions50(b *testing.B) {
+	benchmarkAllowed(b, 50, "OPTIONS")
+}
@@ -0,0 +1,39 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+// MethodAny is the method of the routes registered with Any. Such a route is
+// matched for requests of any method without a route of their own for the
+// path, so the router makes no 405 and no automatic OPTIONS replies for its
+// paths. It is listed with this method by Routes and Walk, and can be removed
+// with it.
+const MethodAny = "*"
+
+// Any registers a request handle with the given path for all methods, which
+// is matched if there is no route for the method of the request, see
+// MethodAny. It is a shortcut for router.Handle(MethodAny, path, handle).
+func (r *Router) Any(path string, handle Handle) *Route {
+	return r.Handle(MethodAny, path, handle)
+}
+
+// HandleMethods registers the request handle with the given path for each of
+// the methods, and returns the registered routes in the same order.
+func (r *Router) HandleMethods(methods []string, path string, handle Handle) []*Route {
+	routes := make([]*Route, len(methods))
+	for i, method := range methods {
+		routes[i] = r.Handle(method, path, handle)
+	}
+	return routes
+}
+
+// lookupAny looks up the route registered with Any for the path, like
+// routes.lookup.
+func (rs *routes) lookupAny(path string, p Params) (handle Handle, ps Params, pattern string, tsr bool) {
+	if rs.counts[MethodAny] == 0 {
+		return nil, nil, "", false
+	}
+	return rs.lookup(MethodAny, path, p)
+}
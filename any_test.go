@@ -0,0 +1,115 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRouterAny(t *testing.T) {
+	for _, unified := range []bool{false, true} {
+		var served string
+		handle := func(name string) Handle {
+			return func(_ http.ResponseWriter, _ *http.Request, _ Params) error {
+				served = name
+				return nil
+			}
+		}
+
+		router := New()
+		router.UnifiedTree = unified
+		router.Any("/hook/:id", handle("any"))
+		router.Post("/hook/:id", handle("post"))
+		router.Get("/user/:name", handle("get"))
+		router.Any("/user/new", handle("new"))
+		router.HandleMethods([]string{"PUT", "PATCH", "PURGE"}, "/item", handle("item"))
+
+		tests := []struct {
+			method, path, served string
+			code                 int
+		}{
+			{"POST", "/hook/1", "post", http.StatusOK},
+			{"GET", "/hook/1", "any", http.StatusOK},
+			{"OPTIONS", "/hook/1", "any", http.StatusOK},
+			{"WEBHOOK", "/hook/1", "any", http.StatusOK},
+			// method-specific routes take precedence, even if less specific
+			{"GET", "/user/new", "get", http.StatusOK},
+			{"DELETE", "/user/new", "new", http.StatusOK},
+			{"DELETE", "/user/gopher", "", http.StatusMethodNotAllowed},
+			{"PURGE", "/item", "item", http.StatusOK},
+			{"GET", "/item", "", http.StatusMethodNotAllowed},
+			{"GET", "/nope", "", http.StatusNotFound},
+		}
+		for _, test := range tests {
+			served = ""
+			r, _ := http.NewRequest(test.method, test.path, nil)
+			w := httptest.NewRecorder()
+			err := router.ServeHTTP(w, r)
+			code := w.Code
+			if he, ok := err.(interface{ Code() int }); ok {
+				code = he.Code()
+			}
+			if served != test.served || code != test.code {
+				t.Errorf("unified %v, %s %s: want %q %d, got %q %d", unified, test.method, test.path, test.served, test.code, served, code)
+			}
+		}
+
+		// the routes for any method are not listed as allowed
+		r, _ := http.NewRequest("OPTIONS", "/user/gopher", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS" {
+			t.Errorf("unified %v: wrong Allow header: %q", unified, allow)
+		}
+		if _, allow := router.getRoutes().allowed("*", false); len(allow) != 1 || allow[0] != "GET, PATCH, POST, PURGE, PUT, OPTIONS" {
+			t.Errorf("unified %v: wrong Allow header for the server: %q", unified, allow)
+		}
+
+		// trailing slashes are redirected to them as well
+		r, _ = http.NewRequest("DELETE", "/hook/1/", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != "/hook/1" {
+			t.Errorf("unified %v: wrong redirect: %d %v", unified, w.Code, w.Header())
+		}
+
+		if !router.Remove(MethodAny, "/hook/:id") {
+			t.Errorf("unified %v: route for any method was not removed", unified)
+		}
+		r, _ = http.NewRequest("GET", "/hook/1", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST, OPTIONS" {
+			t.Errorf("unified %v: wrong reply after removal: %d %v", unified, w.Code, w.Header())
+		}
+	}
+}
+
+func TestRouterAnyCORS(t *testing.T) {
+	var served bool
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error {
+		served = true
+		return nil
+	}
+
+	router := New()
+	router.Any("/hook", handle).CORS(&CORS{AllowedOrigins: []string{"*"}})
+
+	w, err := preflight(router, "/hook", "https://example.com", "PURGE", "")
+	if err != nil || served || w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Methods") != "PURGE" {
+		t.Errorf("wrong preflight reply: %d %v %v", w.Code, w.Header(), err)
+	}
+
+	r, _ := http.NewRequest("PURGE", "/hook", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !served || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("wrong response: %v", w.Header())
+	}
+}
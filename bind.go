@@ -0,0 +1,281 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"encoding"
+	"errors"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+// BindError is the error returned by Params.Bind if values of parameters are
+// missing or invalid. It is a httperror.HttpError with the status code 400,
+// whose message names all of them.
+type BindError struct {
+	httperror.HttpError
+	// Errors are the errors of the parameters, in the order of the fields.
+	Errors []*ParamError
+}
+
+// Bind decodes the values of the parameters into the fields of the struct dst
+// points to, which are tagged with the name of their parameter:
+//
+//	var req struct {
+//		ID     int       `param:"id,required"`
+//		Page   uint      `param:"page" default:"1"`
+//		Since  time.Time `param:"since"`
+//		Format *string   `param:"format"`
+//	}
+//	if err := ps.Bind(&req); err != nil {
+//		return err
+//	}
+//
+// Fields can be strings, bools, integers and floats, types implementing
+// encoding.TextUnmarshaler like time.Time, or pointers to them, which are
+// only set if there is a value. The fields of embedded structs are bound as
+// well, while untagged fields and fields tagged with "-" are skipped.
+//
+// If there is no parameter for a field, its default value is used, if it is
+// tagged with one, or the field is left as it is, unless it is required. All
+// missing and invalid values are reported together in a *BindError. Other
+// errors, e.g. for fields of an unsupported type, are programming errors.
+//
+// The fields of a type are looked up once, and cached.
+func (ps Params) Bind(dst interface{}) error {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return errors.New("Bind needs a non-nil pointer to a struct")
+	}
+	v = v.Elem()
+
+	fields, err := bindFieldsOf(v.Type())
+	if err != nil {
+		return err
+	}
+
+	var errs []*ParamError
+	for i := range fields {
+		f := &fields[i]
+		value, ok := paramValue(ps, f.name)
+		if !ok {
+			if f.required {
+				errs = append(errs, newParamError(f.name, "", f.expected, nil).(*ParamError))
+				continue
+			}
+			if !f.hasDefault {
+				continue
+			}
+			value = f.defaultValue
+		}
+		if err := f.decode(v.FieldByIndex(f.index), value); err != nil {
+			errs = append(errs, newParamError(f.name, value, f.expected, err).(*ParamError))
+		}
+	}
+	if len(errs) > 0 {
+		return newBindError(errs)
+	}
+	return nil
+}
+
+func newBindError(errs []*ParamError) error {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Message()
+	}
+	return &BindError{
+		HttpError: httperror.New(http.StatusBadRequest, strings.Join(msgs, "; "), false),
+		Errors:    errs,
+	}
+}
+
+// checkBindParams checks that the fields of the struct type t bind exactly
+// the parameters of the path, for the typed handles.
+func checkBindParams(t reflect.Type, path string) error {
+	if t.Kind() != reflect.Struct {
+		return errors.New("parameters of path '" + path + "' bound to " + t.String() + ", which is not a struct")
+	}
+	fields, err := bindFieldsOf(t)
+	if err != nil {
+		return err
+	}
+
+	keys := paramKeys(path)
+	for _, f := range fields {
+		found := false
+		for _, key := range keys {
+			found = found || key == f.name
+		}
+		if !found {
+			return errors.New("" + t.String() + " binds parameter " + f.name + ", which is not in path '" + path + "'")
+		}
+	}
+	for _, key := range keys {
+		found := false
+		for _, f := range fields {
+			found = found || f.name == key
+		}
+		if !found {
+			return errors.New("parameter " + key + " of path '" + path + "' is not bound by " + t.String())
+		}
+	}
+	return nil
+}
+
+// bindField is a field of a struct bound by Params.Bind.
+type bindField struct {
+	index        []int
+	name         string
+	required     bool
+	hasDefault   bool
+	defaultValue string
+	// expected describes the values of the field, for errors
+	expected string
+	decode   func(v reflect.Value, s string) error
+}
+
+type bindFields struct {
+	fields []bindField
+	err    error
+}
+
+// bindCache holds the *bindFields of struct types
+var bindCache sync.Map
+
+func bindFieldsOf(t reflect.Type) ([]bindField, error) {
+	if c, ok := bindCache.Load(t); ok {
+		bf := c.(*bindFields)
+		return bf.fields, bf.err
+	}
+	fields, err := appendBindFields(nil, t, nil)
+	bindCache.Store(t, &bindFields{fields, err})
+	return fields, err
+}
+
+// appendBindFields appends the bound fields of the struct type t, which is
+// embedded at the index, to fields.
+func appendBindFields(fields []bindField, t reflect.Type, index []int) ([]bindField, error) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag, tagged := sf.Tag.Lookup("param")
+		fieldIndex := append(append(make([]int, 0, len(index)+1), index...), i)
+
+		if !tagged {
+			if sf.Anonymous && sf.Type.Kind() == reflect.Struct {
+				var err error
+				if fields, err = appendBindFields(fields, sf.Type, fieldIndex); err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+		if tag == "-" {
+			continue
+		}
+		if len(sf.PkgPath) > 0 {
+			return nil, errors.New("Bind of unexported field " + t.String() + "." + sf.Name)
+		}
+
+		f := bindField{index: fieldIndex, name: tag}
+		if i := strings.IndexByte(tag, ','); i >= 0 {
+			f.name = tag[:i]
+			for _, opt := range strings.Split(tag[i+1:], ",") {
+				switch opt {
+				case "required":
+					f.required = true
+				default:
+					return nil, errors.New("unknown Bind option " + opt + " of field " + t.String() + "." + sf.Name)
+				}
+			}
+		}
+		if len(f.name) == 0 {
+			f.name = sf.Name
+		}
+
+		var ok bool
+		if f.decode, f.expected, ok = bindDecoder(sf.Type); !ok {
+			return nil, errors.New("Bind of field " + t.String() + "." + sf.Name + " of unsupported type " + sf.Type.String())
+		}
+		if f.defaultValue, f.hasDefault = sf.Tag.Lookup("default"); f.hasDefault {
+			if err := f.decode(reflect.New(sf.Type).Elem(), f.defaultValue); err != nil {
+				return nil, errors.New("invalid default value of field " + t.String() + "." + sf.Name + ": " + err.Error())
+			}
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// bindDecoder returns the function decoding a value into a field of the type
+// t, and the description of the values, or false if t is unsupported.
+func bindDecoder(t reflect.Type) (func(reflect.Value, string) error, string, bool) {
+	if reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return func(v reflect.Value, s string) error {
+			return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+		}, t.String(), true
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		decode, expected, ok := bindDecoder(t.Elem())
+		if !ok || t.Elem().Kind() == reflect.Ptr {
+			return nil, "", false
+		}
+		return func(v reflect.Value, s string) error {
+			p := reflect.New(t.Elem())
+			if err := decode(p.Elem(), s); err != nil {
+				return err
+			}
+			v.Set(p)
+			return nil
+		}, expected, true
+	case reflect.String:
+		return func(v reflect.Value, s string) error {
+			v.SetString(s)
+			return nil
+		}, "string", true
+	case reflect.Bool:
+		return func(v reflect.Value, s string) error {
+			b, err := strconv.ParseBool(s)
+			if err == nil {
+				v.SetBool(b)
+			}
+			return err
+		}, "boolean", true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return func(v reflect.Value, s string) error {
+			i, err := strconv.ParseInt(s, 10, t.Bits())
+			if err == nil {
+				v.SetInt(i)
+			}
+			return err
+		}, "integer", true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return func(v reflect.Value, s string) error {
+			i, err := strconv.ParseUint(s, 10, t.Bits())
+			if err == nil {
+				v.SetUint(i)
+			}
+			return err
+		}, "unsigned integer", true
+	case reflect.Float32, reflect.Float64:
+		return func(v reflect.Value, s string) error {
+			f, err := strconv.ParseFloat(s, t.Bits())
+			if err == nil {
+				v.SetFloat(f)
+			}
+			return err
+		}, "number", true
+	}
+	return nil, "", false
+}
@@ -0,0 +1,150 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+// upper is an encoding.TextUnmarshaler for the tests.
+type upper string
+
+func (u *upper) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		return errors.New("empty")
+	}
+	*u = upper(strings.ToUpper(string(text)))
+	return nil
+}
+
+type bindPaging struct {
+	Page uint `param:"page" default:"1"`
+	Size int8 `param:"size" default:"20"`
+}
+
+type bindRequest struct {
+	bindPaging
+	ID      int64     `param:"id,required"`
+	Name    string    `param:"name"`
+	Score   float32   `param:"score"`
+	Active  *bool     `param:"active"`
+	Since   time.Time `param:"since"`
+	Code    upper     `param:"code"`
+	Ref     *upper    `param:"ref"`
+	Skipped string    `param:"-"`
+	Plain   string
+}
+
+func TestParamsBind(t *testing.T) {
+	ps := Params{
+		{"id", "42"},
+		{"name", "gopher"},
+		{"score", "1.5"},
+		{"active", "true"},
+		{"since", "2017-08-15T10:00:00Z"},
+		{"code", "abc"},
+		{"ref", "def"},
+		{"size", "50"},
+		{"Skipped", "no"},
+		{"Plain", "no"},
+	}
+
+	req := bindRequest{Plain: "kept"}
+	if err := ps.Bind(&req); err != nil {
+		t.Fatal(err)
+	}
+	active, ref := true, upper("DEF")
+	want := bindRequest{
+		bindPaging: bindPaging{Page: 1, Size: 50},
+		ID:         42,
+		Name:       "gopher",
+		Score:      1.5,
+		Active:     &active,
+		Since:      time.Date(2017, 8, 15, 10, 0, 0, 0, time.UTC),
+		Code:       "ABC",
+		Ref:        &ref,
+		Plain:      "kept",
+	}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("wrong bound values:\nwant %+v\ngot  %+v", want, req)
+	}
+
+	// optional fields without values are left as they are
+	req = bindRequest{Name: "kept"}
+	if err := (Params{{"id", "1"}}).Bind(&req); err != nil {
+		t.Fatal(err)
+	}
+	if req.ID != 1 || req.Name != "kept" || req.Active != nil || req.Ref != nil || req.Page != 1 || req.Size != 20 {
+		t.Errorf("wrong values of optional fields: %+v", req)
+	}
+}
+
+func TestParamsBindErrors(t *testing.T) {
+	ps := Params{
+		{"size", "1000"},
+		{"score", "high"},
+		{"code", ""},
+		{"active", "maybe"},
+	}
+	err := ps.Bind(new(bindRequest))
+	e, ok := err.(*BindError)
+	if !ok {
+		t.Fatalf("want a *BindError, got %v", err)
+	}
+	var he httperror.HttpError = e
+	if he.Code() != http.StatusBadRequest {
+		t.Errorf("wrong status code: %d", he.Code())
+	}
+
+	var names []string
+	for _, pe := range e.Errors {
+		names = append(names, pe.Name)
+	}
+	if want := []string{"size", "id", "score", "active", "code"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("wrong parameters: want %v, got %v", want, names)
+	}
+	msg := "invalid value for parameter size: integer expected; missing value for parameter id; " +
+		"invalid value for parameter score: number expected; invalid value for parameter active: boolean expected; " +
+		"missing value for parameter code"
+	if e.Error() != msg {
+		t.Errorf("wrong message:\nwant %s\ngot  %s", msg, e.Error())
+	}
+
+	// programming errors are not bad requests
+	var s struct {
+		C chan int `param:"c"`
+	}
+	var u struct {
+		N int `param:"n,optional"`
+	}
+	var d struct {
+		N int `param:"n" default:"x"`
+	}
+	for _, dst := range []interface{}{nil, bindRequest{}, new(int), (*bindRequest)(nil), &s, &u, &d} {
+		if err := ps.Bind(dst); err == nil {
+			t.Errorf("binding %T succeeded", dst)
+		} else if _, ok := err.(httperror.HttpError); ok {
+			t.Errorf("binding %T failed with a http error: %v", dst, err)
+		}
+	}
+}
+
+func BenchmarkParamsBind(b *testing.B) {
+	ps := Params{{"id", "42"}, {"name", "gopher"}, {"page", "3"}}
+	var req bindRequest
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ps.Bind(&req)
+	}
+}
@@ -0,0 +1,201 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"errors"
+	"regexp"
+	"sync"
+)
+
+// Constraint reports whether the value of a named parameter is acceptable.
+// Constraints are attached to named parameters in the registered path, as in
+// /user/:id<int>. If the value of a parameter is not acceptable, the route
+// doesn't match and the router tries the other candidates for the path.
+type Constraint func(value string) bool
+
+// paramConstraint is a constraint as attached to a param node.
+type paramConstraint struct {
+	// expr is the constraint as written in the path, without the angle
+	// brackets, e.g. int or [a-z]+
+	expr  string
+	match Constraint
+}
+
+var constraints = struct {
+	sync.RWMutex
+	named    map[string]Constraint
+	compiled map[string]*paramConstraint
+}{
+	named: map[string]Constraint{
+		"int":   isInt,
+		"uint":  isUint,
+		"alpha": isAlpha,
+		"alnum": isAlnum,
+		"hex":   isHex,
+		"uuid":  isUUID,
+	},
+	compiled: make(map[string]*paramConstraint),
+}
+
+// RegisterConstraint registers a named constraint type, which can then be used
+// in paths registered afterwards, as in /post/:slug<slug>.
+// The names int, uint, alpha, alnum, hex and uuid are predefined. Registering
+// the same name twice panics.
+func RegisterConstraint(name string, c Constraint) {
+	if !isIdent(name) {
+		panic("constraint name must be an identifier, has: '" + name + "'")
+	}
+	if c == nil {
+		panic("constraint '" + name + "' must not be nil")
+	}
+
+	constraints.Lock()
+	defer constraints.Unlock()
+	if _, ok := constraints.named[name]; ok {
+		panic("constraint '" + name + "' is already registered")
+	}
+	constraints.named[name] = c
+}
+
+// getConstraint resolves the constraint expression of a path like
+// lookupConstraint, but panics if it is invalid.
+func getConstraint(expr, path string) *paramConstraint {
+	pc, err := lookupConstraint(expr)
+	if err != nil {
+		panic(err.Error() + " in path '" + path + "'")
+	}
+	return pc
+}
+
+// lookupConstraint resolves a constraint expression. A registered name is
+// used as it is, anything else is compiled as a regular expression that has
+// to match the whole value.
+func lookupConstraint(expr string) (*paramConstraint, error) {
+	constraints.RLock()
+	pc := constraints.compiled[expr]
+	constraints.RUnlock()
+	if pc != nil {
+		return pc, nil
+	}
+
+	constraints.Lock()
+	defer constraints.Unlock()
+
+	if c, ok := constraints.named[expr]; ok {
+		pc = &paramConstraint{expr: expr, match: c}
+	} else if isIdent(expr) {
+		return nil, errors.New("unknown constraint type '" + expr + "'")
+	} else {
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return nil, errors.New("invalid constraint '" + expr + "': " + err.Error())
+		}
+		pc = &paramConstraint{expr: expr, match: re.MatchString}
+	}
+	constraints.compiled[expr] = pc
+	return pc, nil
+}
+
+func isIdent(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c != '_' && !isLetter(c) && (i == 0 || !isDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+func isHexDigit(c byte) bool {
+	return isDigit(c) || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func isUint(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isInt(s string) bool {
+	if len(s) > 1 && (s[0] == '-' || s[0] == '+') {
+		s = s[1:]
+	}
+	return isUint(s)
+}
+
+func isAlpha(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isLetter(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isAlnum(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isLetter(s[i]) && !isDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+func isHex(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if !isHexDigit(s[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// isUUID accepts the canonical 8-4-4-4-12 form of a UUID.
+func isUUID(s string) bool {
+	if len(s) != 36 {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		switch i {
+		case 8, 13, 18, 23:
+			if s[i] != '-' {
+				return false
+			}
+		default:
+			if !isHexDigit(s[i]) {
+				return false
+			}
+		}
+	}
+	return true
+}
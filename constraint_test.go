@@ -0,0 +1,138 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+func TestConstraintTypes(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"int", "42", true},
+		{"int", "-42", true},
+		{"int", "+42", true},
+		{"int", "-", false},
+		{"int", "4x", false},
+		{"int", "", false},
+		{"uint", "42", true},
+		{"uint", "-42", false},
+		{"alpha", "gopher", true},
+		{"alpha", "gopher1", false},
+		{"alnum", "gopher1", true},
+		{"alnum", "go-pher", false},
+		{"hex", "deadBEEF", true},
+		{"hex", "0xdead", false},
+		{"uuid", "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0", true},
+		{"uuid", "0b1c2d3e4f5061728394a5b6c7d8e9f0", false},
+		{"uuid", "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9fg", false},
+	}
+	for _, test := range tests {
+		pc := getConstraint(test.name, "/:x<"+test.name+">")
+		if ok := pc.match(test.value); ok != test.ok {
+			t.Errorf("constraint %s for value '%s': want %t, got %t", test.name, test.value, test.ok, ok)
+		}
+	}
+}
+
+func TestConstraintRegexp(t *testing.T) {
+	pc := getConstraint("[a-z]+", "/:x<[a-z]+>")
+	if !pc.match("abc") {
+		t.Error("regexp constraint did not match")
+	}
+	// the whole value must match
+	if pc.match("abc1") || pc.match("1abc") {
+		t.Error("regexp constraint matched a part of the value")
+	}
+	if getConstraint("[a-z]+", "/:y<[a-z]+>") != pc {
+		t.Error("regexp constraint was compiled again")
+	}
+}
+
+func TestRegisterConstraint(t *testing.T) {
+	RegisterConstraint("testEven", func(value string) bool {
+		return isUint(value) && (value[len(value)-1]-'0')%2 == 0
+	})
+
+	if recv := catchPanic(func() { RegisterConstraint("testEven", isUint) }); recv == nil {
+		t.Error("registering a constraint twice did not panic")
+	}
+	if recv := catchPanic(func() { RegisterConstraint("int", isUint) }); recv == nil {
+		t.Error("registering a predefined constraint did not panic")
+	}
+	if recv := catchPanic(func() { RegisterConstraint("[0-9]", isUint) }); recv == nil {
+		t.Error("registering a constraint with an invalid name did not panic")
+	}
+	if recv := catchPanic(func() { RegisterConstraint("testNil", nil) }); recv == nil {
+		t.Error("registering a nil constraint did not panic")
+	}
+
+	tree := &node{}
+	tree.addRoute("/n/:n<testEven>", fakeHandler("/n/:n<testEven>"))
+	checkRequests(t, tree, testRequests{
+		{"/n/42", false, "/n/:n<testEven>", Params{Param{"n", "42"}}},
+		{"/n/43", true, "", nil},
+	})
+}
+
+func TestRouterConstraints(t *testing.T) {
+	var routed string
+	handle := func(route string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, _ Params) error {
+			routed = route
+			return nil
+		}
+	}
+
+	router := New()
+	router.Get("/user/:id<int>", handle("get"))
+	router.Delete("/user/:name<alpha>", handle("delete"))
+
+	r, _ := http.NewRequest("GET", "/user/42", nil)
+	if err := router.ServeHTTP(httptest.NewRecorder(), r); err != nil || routed != "get" {
+		t.Errorf("routing constrained route failed: %v", err)
+	}
+
+	// the value doesn't match the GET route, but the DELETE route
+	routed = ""
+	r, _ = http.NewRequest("GET", "/user/gopher", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if routed != "" {
+		t.Errorf("value not matching the constraint reached the handle")
+	}
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	} else if allow := w.Header().Get("Allow"); allow != "DELETE, OPTIONS" {
+		t.Error("unexpected Allow header value: " + allow)
+	}
+
+	// the value doesn't match any route
+	r, _ = http.NewRequest("GET", "/user/go-pher", nil)
+	e, ok := router.ServeHTTP(httptest.NewRecorder(), r).(httperror.HttpError)
+	if !ok || e.Code() != http.StatusNotFound {
+		t.Errorf("NotFound handling failed: %v", e)
+	}
+	if routed != "" {
+		t.Errorf("value not matching the constraint reached the handle")
+	}
+
+	// a value matching the constraint only in another case isn't redirected
+	r, _ = http.NewRequest("GET", "/USER/gopher", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if loc := w.Header().Get("Location"); strings.HasPrefix(loc, "/user/gopher") {
+		t.Errorf("redirected to a path not matching the constraint: %s", loc)
+	}
+}
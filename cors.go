@@ -0,0 +1,250 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+// CORS is a policy for cross-origin resource sharing, see Router.CORS.
+//
+// The preflight requests are answered by the router, with the methods allowed
+// for the path as Access-Control-Allow-Methods. The other requests from an
+// allowed origin are served with the headers of the policy set.
+type CORS struct {
+	// AllowedOrigins are the origins allowed to make cross-origin requests,
+	// e.g. https://example.com, which are compared case-insensitively. The
+	// origin * allows any origin.
+	AllowedOrigins []string
+
+	// AllowOrigin, if set, reports whether an origin not in AllowedOrigins
+	// is allowed to make cross-origin requests.
+	AllowOrigin func(origin string) bool
+
+	// AllowedHeaders are the request headers, e.g. Content-Type, allowed in
+	// cross-origin requests, which are compared case-insensitively. The
+	// header * allows any header.
+	AllowedHeaders []string
+
+	// ExposedHeaders are the response headers the client is allowed to read,
+	// besides the CORS-safelisted ones.
+	ExposedHeaders []string
+
+	// If enabled, the client is allowed to make requests with credentials,
+	// like cookies. This only applies to the origins allowed by name or by
+	// AllowOrigin, not to the ones allowed by the origin *.
+	AllowCredentials bool
+
+	// MaxAge is how long the client may cache the reply to a preflight
+	// request, which is sent in whole seconds. It is left to the client if
+	// zero.
+	MaxAge time.Duration
+}
+
+// corsKey is the key of the CORS policy of a route, by method and path.
+type corsKey struct {
+	method, path string
+}
+
+// CORS sets the CORS policy of the route, which overrides the one of the
+// router for requests matching the route, and for preflight requests for them.
+// It returns the route, and panics if it was removed, like Name.
+func (rt *Route) CORS(policy *CORS) *Route {
+	r := rt.router
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rt.checkRegistered()
+	r.updateCORS(corsKey{rt.method, rt.path}, policy)
+	return rt
+}
+
+// updateCORS sets the CORS policy of the route with the given key, or removes
+// it if policy is nil. The caller must hold r.mu.
+func (r *Router) updateCORS(key corsKey, policy *CORS) {
+	rs, _ := r.routes.Load().(*routes)
+	if rs == nil {
+		return
+	}
+	if r.CopyOnWrite {
+		c := *rs
+		c.cors = copyCORS(rs.cors)
+		rs = &c
+	} else if rs.cors == nil {
+		rs.cors = make(map[corsKey]*CORS)
+	}
+
+	if policy == nil {
+		delete(rs.cors, key)
+	} else {
+		rs.cors[key] = policy
+	}
+	if r.CopyOnWrite {
+		r.routes.Store(rs)
+	}
+}
+
+// copyCORS returns a copy of the CORS policies of routes.
+func copyCORS(cors map[corsKey]*CORS) map[corsKey]*CORS {
+	c := make(map[corsKey]*CORS, len(cors)+1)
+	for k, p := range cors {
+		c[k] = p
+	}
+	return c
+}
+
+// corsPolicy returns the CORS policy for the route of the method with the
+// given path, as it was registered, or the one of the router.
+func (r *Router) corsPolicy(rs *routes, method, pattern string) *CORS {
+	if len(rs.cors) > 0 && len(pattern) > 0 {
+		if policy := rs.cors[corsKey{method, pattern}]; policy != nil {
+			return policy
+		}
+	}
+	return r.CORS
+}
+
+// handleCORS answers a preflight request, unless a handle of its own was
+// matched for it, and reports whether it did. Otherwise it sets the headers
+// of the CORS policy for the request. The reply varies by Origin whenever a
+// policy applies, so that caches don't serve it for other origins, even if
+// the request has none.
+func (r *Router) handleCORS(w http.ResponseWriter, req *http.Request, rc *routeContext) (bool, error) {
+	path := req.URL.Path
+	origin := req.Header.Get("Origin")
+	reqMethod := req.Header.Get("Access-Control-Request-Method")
+	if req.Method != "OPTIONS" || len(origin) == 0 || len(reqMethod) == 0 || (rc.handle != nil && rc.method == "OPTIONS") {
+		if policy := r.corsPolicy(rc.routes, rc.method, rc.pattern); policy != nil {
+			h := w.Header()
+			h.Add("Vary", "Origin")
+			if len(origin) > 0 && policy.allows(origin) {
+				policy.setOrigin(h, origin)
+				if len(policy.ExposedHeaders) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(policy.ExposedHeaders, ", "))
+				}
+			}
+		}
+		return false, nil
+	}
+
+	var m methodMatch
+	method := reqMethod
+	handle, _, pattern, _ := rc.routes.lookupMatch(reqMethod, path, nil, &m)
+	if handle == nil && r.HandleHead && reqMethod == "HEAD" {
+		method = "GET"
+		handle, _, pattern, _ = rc.routes.lookupHead(path, nil)
+	}
+	if handle == nil {
+		method = MethodAny
+		handle, _, pattern, _ = rc.routes.lookupAny(path, nil)
+	}
+	policy := r.corsPolicy(rc.routes, method, pattern)
+	if policy == nil {
+		return false, nil
+	}
+
+	h := w.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	allowed, allow := rc.routes.matchAllowed(path, &m, r.HandleHead)
+	if handle == nil && len(allowed) == 0 {
+		return true, handleNotFound(r, w, req)
+	}
+	if !policy.allows(origin) {
+		return true, httperror.New(http.StatusForbidden, "cors origin not allowed", false)
+	}
+	if handle == nil {
+		return true, httperror.New(http.StatusForbidden, "cors method not allowed", false)
+	}
+	if method == MethodAny {
+		// the route allows any method, which can't be listed
+		allow = []string{reqMethod}
+	}
+	reqHeaders := req.Header.Get("Access-Control-Request-Headers")
+	if !policy.allowHeaders(reqHeaders) {
+		return true, httperror.New(http.StatusForbidden, "cors headers not allowed", false)
+	}
+
+	policy.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", allow[0])
+	if len(reqHeaders) > 0 {
+		h.Set("Access-Control-Allow-Headers", reqHeaders)
+	}
+	if policy.MaxAge > 0 {
+		h.Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge/time.Second)))
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return true, nil
+}
+
+// allows reports whether the origin is allowed to make cross-origin
+// requests.
+func (c *CORS) allows(origin string) bool {
+	return contains(c.AllowedOrigins, "*") || c.allowsByName(origin)
+}
+
+// allowsByName reports whether the origin is allowed other than as any
+// origin.
+func (c *CORS) allowsByName(origin string) bool {
+	return containsFold(c.AllowedOrigins, origin) || (c.AllowOrigin != nil && c.AllowOrigin(origin))
+}
+
+// setOrigin sets the headers allowing the origin.
+func (c *CORS) setOrigin(h http.Header, origin string) {
+	// Credentials are only allowed for the origins allowed by name or by
+	// AllowOrigin. The others are allowed as any origin, which must not be
+	// combined with credentials, so that not every site can make requests
+	// with them.
+	if !c.AllowCredentials || !c.allowsByName(origin) {
+		if contains(c.AllowedOrigins, "*") {
+			h.Set("Access-Control-Allow-Origin", "*")
+			return
+		}
+	}
+	h.Set("Access-Control-Allow-Origin", origin)
+	if c.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+// allowHeaders reports whether the headers of the comma-separated list are
+// allowed.
+func (c *CORS) allowHeaders(headers string) bool {
+	if len(headers) == 0 || contains(c.AllowedHeaders, "*") {
+		return true
+	}
+	for _, header := range strings.Split(headers, ",") {
+		if header = strings.TrimSpace(header); len(header) > 0 && !containsFold(c.AllowedHeaders, header) {
+			return false
+		}
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,261 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+func preflight(router *Router, path, origin, method, headers string) (*httptest.ResponseRecorder, error) {
+	r, _ := http.NewRequest("OPTIONS", path, nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if len(headers) > 0 {
+		r.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	w := httptest.NewRecorder()
+	return w, router.ServeHTTP(w, r)
+}
+
+func TestRouterCORSPreflight(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.CORS = &CORS{
+		AllowedOrigins: []string{"https://example.com"},
+		AllowedHeaders: []string{"Content-Type", "X-Token"},
+		MaxAge:         10 * time.Minute,
+	}
+	router.Get("/user/:name", handle)
+	router.Put("/user/:name", handle)
+
+	w, err := preflight(router, "/user/gopher", "https://EXAMPLE.com", "PUT", "content-type, x-token")
+	if err != nil || w.Code != http.StatusNoContent {
+		t.Fatalf("preflight failed: %d %v", w.Code, err)
+	}
+	want := http.Header{
+		"Access-Control-Allow-Origin":  {"https://EXAMPLE.com"},
+		"Access-Control-Allow-Methods": {"GET, PUT, OPTIONS"},
+		"Access-Control-Allow-Headers": {"content-type, x-token"},
+		"Access-Control-Max-Age":       {"600"},
+		"Vary":                         {"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"},
+	}
+	if !reflect.DeepEqual(w.Header(), want) {
+		t.Errorf("wrong preflight reply:\nwant %v\ngot  %v", want, w.Header())
+	}
+
+	tests := []struct {
+		name, origin, method, headers string
+	}{
+		{"origin", "https://other.com", "PUT", ""},
+		{"method", "https://example.com", "DELETE", ""},
+		{"headers", "https://example.com", "PUT", "Content-Type, X-Other"},
+	}
+	for _, test := range tests {
+		w, err := preflight(router, "/user/gopher", test.origin, test.method, test.headers)
+		if he, ok := err.(httperror.HttpError); !ok || he.Code() != http.StatusForbidden {
+			t.Errorf("disallowed %s: want 403 error, got %v", test.name, err)
+		}
+		if len(w.Header().Get("Access-Control-Allow-Origin")) > 0 {
+			t.Errorf("disallowed %s was allowed: %v", test.name, w.Header())
+		}
+		if len(w.Header()["Vary"]) != 3 {
+			t.Errorf("disallowed %s is missing Vary: %v", test.name, w.Header())
+		}
+	}
+
+	// unknown paths are not found
+	if _, err := preflight(router, "/nope", "https://example.com", "GET", ""); err == nil {
+		t.Error("preflight for unknown path succeeded")
+	} else if he, ok := err.(httperror.HttpError); !ok || he.Code() != http.StatusNotFound {
+		t.Errorf("preflight for unknown path: want 404 error, got %v", err)
+	}
+
+	// OPTIONS requests that are not preflights are answered as usual
+	r, _ := http.NewRequest("OPTIONS", "/user/gopher", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusOK || w.Header().Get("Allow") != "GET, PUT, OPTIONS" ||
+		w.Header().Get("Access-Control-Allow-Origin") != "https://example.com" {
+		t.Errorf("wrong OPTIONS reply: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestRouterCORSResponse(t *testing.T) {
+	var served bool
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error {
+		served = true
+		return nil
+	}
+
+	router := New()
+	router.CORS = &CORS{
+		AllowedOrigins:   []string{"https://example.com"},
+		ExposedHeaders:   []string{"X-Total", "X-Page"},
+		AllowCredentials: true,
+	}
+	router.Get("/path", handle)
+
+	r, _ := http.NewRequest("GET", "/path", nil)
+	r.Header.Set("Origin", "https://example.com")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !served {
+		t.Fatal("route was not served")
+	}
+	want := http.Header{
+		"Access-Control-Allow-Origin":      {"https://example.com"},
+		"Access-Control-Allow-Credentials": {"true"},
+		"Access-Control-Expose-Headers":    {"X-Total, X-Page"},
+		"Vary":                             {"Origin"},
+	}
+	if !reflect.DeepEqual(w.Header(), want) {
+		t.Errorf("wrong response headers:\nwant %v\ngot  %v", want, w.Header())
+	}
+
+	// without credentials, any origin is allowed as such
+	router.CORS = &CORS{AllowedOrigins: []string{"*"}}
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("wrong allowed origin: %v", w.Header())
+	}
+
+	// and with credentials, which only the origins allowed by name get
+	router.CORS = &CORS{AllowedOrigins: []string{"*", "https://ok.com"}, AllowCredentials: true}
+	for origin, want := range map[string]http.Header{
+		"https://example.com": {
+			"Access-Control-Allow-Origin": {"*"},
+			"Vary":                        {"Origin"},
+		},
+		"https://ok.com": {
+			"Access-Control-Allow-Origin":      {"https://ok.com"},
+			"Access-Control-Allow-Credentials": {"true"},
+			"Vary":                             {"Origin"},
+		},
+	} {
+		r.Header.Set("Origin", origin)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if !reflect.DeepEqual(w.Header(), want) {
+			t.Errorf("wrong response headers for %s:\nwant %v\ngot  %v", origin, want, w.Header())
+		}
+	}
+	r.Header.Set("Origin", "https://example.com")
+
+	// disallowed origins are served without the headers
+	router.CORS = &CORS{AllowOrigin: func(origin string) bool { return origin == "https://ok.com" }}
+	served = false
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if !served || len(w.Header().Get("Access-Control-Allow-Origin")) > 0 || w.Header().Get("Vary") != "Origin" {
+		t.Errorf("wrong response for disallowed origin: %v", w.Header())
+	}
+
+	// same-origin requests get no CORS headers, but the reply still varies
+	// by Origin, so that it isn't cached for cross-origin requests
+	r.Header.Del("Origin")
+	served = false
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if want := (http.Header{"Vary": {"Origin"}}); !served || !reflect.DeepEqual(w.Header(), want) {
+		t.Errorf("wrong same-origin response headers:\nwant %v\ngot  %v", want, w.Header())
+	}
+
+	// as do the ones of a route with a policy of its own
+	router.CORS = nil
+	router.Get("/route", handle)
+	router.Get("/other", handle).CORS(&CORS{AllowedOrigins: []string{"*"}})
+	for path, vary := range map[string]string{"/other": "Origin", "/route": ""} {
+		r, _ = http.NewRequest("GET", path, nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Header().Get("Vary") != vary {
+			t.Errorf("wrong Vary header of %s: want %q, got %q", path, vary, w.Header().Get("Vary"))
+		}
+	}
+}
+
+func TestRouterCORSRoute(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+	var options bool
+	optionsHandle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error {
+		options = true
+		return nil
+	}
+
+	router := New()
+	router.Get("/public/:file", handle).CORS(&CORS{AllowedOrigins: []string{"*"}})
+	router.Get("/private", handle)
+	router.Options("/custom", optionsHandle)
+	router.Post("/custom", handle).CORS(&CORS{AllowedOrigins: []string{"*"}})
+
+	w, err := preflight(router, "/public/a", "https://example.com", "GET", "")
+	if err != nil || w.Code != http.StatusNoContent || w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("preflight for route policy failed: %d %v %v", w.Code, w.Header(), err)
+	}
+
+	// without any policy, preflights are plain OPTIONS requests
+	w, err = preflight(router, "/private", "https://example.com", "GET", "")
+	if err != nil || w.Code != http.StatusOK || len(w.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("preflight without policy: %d %v %v", w.Code, w.Header(), err)
+	}
+
+	// an OPTIONS handle of the path takes precedence
+	w, _ = preflight(router, "/custom", "https://example.com", "POST", "")
+	if !options || w.Code != http.StatusOK {
+		t.Errorf("OPTIONS handle was not called: %d %v", w.Code, w.Header())
+	}
+
+	// the policy of a route overrides the one of the router
+	router.CORS = &CORS{AllowedOrigins: []string{"https://example.com"}}
+	r, _ := http.NewRequest("GET", "/public/a", nil)
+	r.Header.Set("Origin", "https://other.com")
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("route policy was not used: %v", w.Header())
+	}
+
+	// and is removed along with it
+	router.Remove("GET", "/public/:file")
+	router.Get("/public/:file", handle)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if len(w.Header().Get("Access-Control-Allow-Origin")) > 0 {
+		t.Errorf("policy of removed route was used: %v", w.Header())
+	}
+}
+
+func TestRouterCORSCopyOnWrite(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := NewConcurrent()
+	rt := router.Get("/path", handle)
+	rs := router.getRoutes()
+	rt.CORS(&CORS{AllowedOrigins: []string{"*"}})
+	if len(rs.cors) != 0 {
+		t.Errorf("policies of the routes in use modified: %v", rs.cors)
+	}
+	if rs = router.getRoutes(); len(rs.cors) != 1 {
+		t.Fatalf("route policy was not set: %v", rs.cors)
+	}
+
+	router.Remove("GET", "/path")
+	if len(rs.cors) != 1 {
+		t.Errorf("policies of the routes in use modified on removal: %v", rs.cors)
+	}
+	if cors := router.getRoutes().cors; len(cors) != 0 {
+		t.Errorf("route policy was not removed: %v", cors)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+// NotFoundError is the error returned by the router if no route matches the
+// request, and Router.NotFound is not set. It is a httperror.HttpError with
+// the status code 404.
+type NotFoundError struct {
+	httperror.HttpError
+	// Path is the request path no route matched.
+	Path string
+}
+
+// MethodNotAllowedError is the error returned by the router instead of
+// replying with 405 Method Not Allowed, if Router.ReturnMethodErrors is
+// enabled. It is a httperror.HttpError with the status code 405, and the
+// Allow header set.
+type MethodNotAllowedError struct {
+	httperror.HttpError
+	// Allowed are the methods allowed for the path, including OPTIONS.
+	Allowed []string
+}
+
+// OptionsError is the error returned by the router instead of the automatic
+// reply to an OPTIONS request, if Router.ReturnMethodErrors is enabled. It is
+// a httperror.HttpError with the status code 200, and the Allow header set.
+// Like a redirect, it isn't a failure: the chain above is expected to write
+// the reply.
+type OptionsError struct {
+	httperror.HttpError
+	// Allowed are the methods allowed for the path, or for the server if the
+	// path is *, including OPTIONS.
+	Allowed []string
+}
+
+// InvalidPatternError is the error returned by Router.TryHandle if the path
+// of a route is invalid, e.g. since a wildcard has no name.
+type InvalidPatternError struct {
+	// Path is the invalid path.
+	Path string
+	// Offset is the position of the invalid byte of the path.
+	Offset int
+	// Reason describes the problem.
+	Reason string
+}
+
+func newInvalidPatternError(path string, offset int, reason string) error {
+	return &InvalidPatternError{Path: path, Offset: offset, Reason: reason}
+}
+
+func (e *InvalidPatternError) Error() string {
+	return e.Reason + " in path '" + e.Path + "'"
+}
+
+// ConflictError is the error returned by Router.TryHandle if the path of a
+// route conflicts with the path of a route registered for the method, e.g.
+// since their parameters at the same position are named differently.
+type ConflictError struct {
+	// Method is the method of the route.
+	Method string
+	// Path is the path of the route.
+	Path string
+	// Existing is the path of a registered route it conflicts with.
+	Existing string
+	// Segment is the wildcard of Path, including its constraint, which
+	// conflicts with the wildcard of Existing, if they conflict in the tree
+	// of the method.
+	Segment string
+	// Wildcard is the wildcard of Existing, including its constraint, which
+	// Segment conflicts with, if it is set.
+	Wildcard string
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.Segment) == 0 {
+		return "path '" + e.Path + "' conflicts with existing path '" + e.Existing + "'"
+	}
+	prefix := e.Path[:strings.Index(e.Path, e.Segment)] + e.Wildcard
+	return "'" + e.Segment +
+		"' in new path '" + e.Path +
+		"' conflicts with existing wildcard '" + e.Wildcard +
+		"' in existing prefix '" + prefix +
+		"'"
+}
+
+// DuplicateRouteError is the error returned by Router.TryHandle if a route is
+// already registered for the method and path.
+type DuplicateRouteError struct {
+	// Method is the method of the route.
+	Method string
+	// Path is the path of the route.
+	Path string
+}
+
+func (e *DuplicateRouteError) Error() string {
+	return "a handle is already registered for path '" + e.Path + "'"
+}
+
+func newNotFoundError(path string) error {
+	return &NotFoundError{
+		HttpError: httperror.New(http.StatusNotFound, "route not found", false),
+		Path:      path,
+	}
+}
+
+func newMethodNotAllowedError(allowed []string) error {
+	e := &MethodNotAllowedError{
+		HttpError: httperror.New(http.StatusMethodNotAllowed, "method not allowed", false),
+		// copied, since the router's slice is shared by all requests
+		Allowed: append([]string(nil), allowed...),
+	}
+	e.Headers().Set("Allow", strings.Join(allowed, ", "))
+	return e
+}
+
+func newOptionsError(allowed []string) error {
+	e := &OptionsError{
+		HttpError: httperror.New(http.StatusOK, "options request", true),
+		Allowed:   append([]string(nil), allowed...),
+	}
+	e.Headers().Set("Allow", strings.Join(allowed, ", "))
+	return e
+}
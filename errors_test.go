@@ -0,0 +1,259 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+func TestRouterReturnMethodErrors(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.ReturnMethodErrors = true
+	router.Get("/path", handle)
+	router.Post("/path", handle)
+
+	// 405
+	r, _ := http.NewRequest("PUT", "/path", nil)
+	w := httptest.NewRecorder()
+	err := router.ServeHTTP(w, r)
+	if e, ok := err.(*MethodNotAllowedError); !ok {
+		t.Errorf("405 did not return a *MethodNotAllowedError: %v", err)
+	} else {
+		allowed := append([]string(nil), e.Allowed[:len(e.Allowed)-1]...)
+		sort.Strings(allowed)
+		if !reflect.DeepEqual(allowed, []string{"GET", "POST"}) || e.Allowed[len(e.Allowed)-1] != "OPTIONS" {
+			t.Errorf("wrong allowed methods: %v", e.Allowed)
+		}
+		var he httperror.HttpError = e
+		if he.Code() != http.StatusMethodNotAllowed || len(he.Headers().Get("Allow")) == 0 {
+			t.Errorf("wrong http error: %d %v", he.Code(), he.Headers())
+		}
+	}
+	if w.Code != http.StatusOK || len(w.Header()) != 0 {
+		t.Errorf("405 was written: %d %v", w.Code, w.Header())
+	}
+
+	// OPTIONS
+	r, _ = http.NewRequest("OPTIONS", "/path", nil)
+	w = httptest.NewRecorder()
+	err = router.ServeHTTP(w, r)
+	if e, ok := err.(*OptionsError); !ok {
+		t.Errorf("OPTIONS did not return an *OptionsError: %v", err)
+	} else if len(e.Allowed) != 3 || e.Code() != http.StatusOK || len(e.Headers().Get("Allow")) == 0 {
+		t.Errorf("wrong options error: %v %d %v", e.Allowed, e.Code(), e.Headers())
+	}
+	if len(w.Header()) != 0 {
+		t.Errorf("OPTIONS reply was written: %v", w.Header())
+	}
+
+	// 404
+	r, _ = http.NewRequest("GET", "/nope", nil)
+	err = router.ServeHTTP(httptest.NewRecorder(), r)
+	if e, ok := err.(*NotFoundError); !ok || e.Path != "/nope" || e.Code() != http.StatusNotFound {
+		t.Errorf("404 did not return a *NotFoundError: %v", err)
+	}
+
+	// without the methods of the path, 405 and OPTIONS are not found
+	r, _ = http.NewRequest("OPTIONS", "/nope", nil)
+	if _, ok := router.ServeHTTP(httptest.NewRecorder(), r).(*NotFoundError); !ok {
+		t.Error("OPTIONS for unknown path did not return a *NotFoundError")
+	}
+}
+
+func TestRouterMethodErrorsCopied(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.ReturnMethodErrors = true
+	router.Get("/path", handle)
+
+	// modifying the allowed methods of an error doesn't affect later ones
+	for _, method := range [...]string{"PUT", "OPTIONS", "PUT"} {
+		r, _ := http.NewRequest(method, "/path", nil)
+		var allowed []string
+		switch e := router.ServeHTTP(httptest.NewRecorder(), r).(type) {
+		case *MethodNotAllowedError:
+			allowed = e.Allowed
+		case *OptionsError:
+			allowed = e.Allowed
+		}
+		if !reflect.DeepEqual(allowed, []string{"GET", "OPTIONS"}) {
+			t.Fatalf("wrong allowed methods of %s: %v", method, allowed)
+		}
+		allowed[0] = "HACKED"
+	}
+
+	// nor does modifying the header of a reply
+	router.ReturnMethodErrors = false
+	for i := 0; i < 2; i++ {
+		r, _ := http.NewRequest("PUT", "/path", nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if allow := w.Header().Get("Allow"); allow != "GET, OPTIONS" {
+			t.Fatalf("wrong Allow header: %q", allow)
+		}
+		w.Header()["Allow"][0] = "HACKED"
+	}
+}
+
+func TestRouterTryHandle(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	for _, unified := range []bool{false, true} {
+		router := New()
+		router.UnifiedTree = unified
+		for _, path := range []string{"/con:tact", "/who/are/*you", "/user/:id<int>/posts", "/static"} {
+			if err := router.TryHandle("GET", path, handle); err != nil {
+				t.Fatalf("unified %v: registering %s failed: %v", unified, path, err)
+			}
+		}
+		routes := routePaths(router)
+		rs := router.getRoutes()
+
+		invalid := []struct {
+			path   string
+			offset int
+		}{
+			{"", 0},
+			{"nope", 0},
+			{"/:foo:bar", 5},
+			{"/user/:/posts", 6},
+			{"/src/*filepath<int>", 14},
+			{"/user/:id<int", 9},
+			{"/user/:id<>", 9},
+			{"/user/:id<int>x/", 14},
+			{"/user/:id<nope>", 10},
+			{"/user/:id<[a-z>", 10},
+			{"/src/*filepath/x", 5},
+			{"/src*filepath", 4},
+		}
+		for _, test := range invalid {
+			err := router.TryHandle("GET", test.path, handle)
+			if e, ok := err.(*InvalidPatternError); !ok {
+				t.Errorf("unified %v, %q: want an *InvalidPatternError, got %v", unified, test.path, err)
+			} else if e.Path != test.path || e.Offset != test.offset {
+				t.Errorf("unified %v, %q: wrong error: %q at %d", unified, test.path, e.Reason, e.Offset)
+			}
+		}
+
+		err := router.TryHandle("GET", "/static", handle)
+		if e, ok := err.(*DuplicateRouteError); !ok || e.Method != "GET" || e.Path != "/static" {
+			t.Errorf("unified %v: want a *DuplicateRouteError, got %v", unified, err)
+		}
+
+		conflicts := []struct {
+			path, existing string
+		}{
+			{"/con:name", "/con:tact"},
+			{"/who/are/*me", "/who/are/*you"},
+			{"/user/:name<int>/posts", "/user/:id<int>/posts"},
+		}
+		for _, test := range conflicts {
+			err := router.TryHandle("GET", test.path, handle)
+			if e, ok := err.(*ConflictError); !ok || e.Method != "GET" || e.Path != test.path || e.Existing != test.existing {
+				t.Errorf("unified %v: want a *ConflictError for %s, got %#v", unified, test.path, err)
+			}
+		}
+
+		if err := router.TryHandle("GET", "/nil", nil); err == nil {
+			t.Errorf("unified %v: registering nil handle succeeded", unified)
+		}
+
+		// the routes are left unchanged
+		if router.getRoutes() != rs || !reflect.DeepEqual(routePaths(router), routes) {
+			t.Errorf("unified %v: routes changed by failed registrations: %v", unified, routePaths(router))
+		}
+		if h, _, _ := router.Lookup("GET", "/user/42/posts"); h == nil {
+			t.Errorf("unified %v: route not found after failed registrations", unified)
+		}
+		if err := router.TryHandle("POST", "/con:name", handle); err != nil {
+			t.Errorf("unified %v: registering for another method failed: %v", unified, err)
+		}
+
+		// Handle panics with the message of the error
+		recv := catchPanic(func() {
+			router.Get("/static", handle)
+		})
+		if recv != "a handle is already registered for path '/static'" {
+			t.Errorf("unified %v: wrong panic: %v", unified, recv)
+		}
+	}
+}
+
+// routePaths returns the methods and paths of the routes of the router.
+func routePaths(router *Router) []string {
+	var paths []string
+	for _, route := range router.Routes() {
+		paths = append(paths, route.Method+" "+route.Path)
+	}
+	return paths
+}
+
+func TestRouterTryHandleUnifiedConflicts(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	routes := []struct {
+		method, path string
+	}{
+		{"GET", "/user/:id"},
+		{"GET", "/user/:name/x"},
+		{"POST", "/user/:name/x"},
+		{"GET", "/user/:id/x"},
+		{"PUT", "/user/:uid/posts/:post"},
+		{"PUT", "/user/:uid/posts/:name/edit"},
+		{"DELETE", "/user/:uid/posts/:pid"},
+		{"GET", "/user/:id<int>/n"},
+		{"GET", "/user/:num<int>/m"},
+		{"GET", "/src/*filepath"},
+		{"POST", "/src/*path"},
+		{"GET", "/src/*path"},
+		{"GET", "/src/:dir/x"},
+		{"GET", "/user/:id"},
+	}
+
+	// the routes can be registered in either layout alike
+	var results [2][]string
+	for i, unified := range []bool{false, true} {
+		router := New()
+		router.UnifiedTree = unified
+		for _, rt := range routes {
+			err := router.TryHandle(rt.method, rt.path, handle)
+			results[i] = append(results[i], fmt.Sprintf("%s %s: %T %v", rt.method, rt.path, err, err))
+		}
+	}
+	for i := range routes {
+		if results[0][i] != results[1][i] {
+			t.Errorf("registration differs by layout:\n trees   %s\n unified %s", results[0][i], results[1][i])
+		}
+	}
+	if !strings.Contains(results[1][1], "*mrouter.ConflictError") {
+		t.Errorf("conflicting wildcard name registered: %s", results[1][1])
+	}
+}
+
+func TestRouterTryHandleCopyOnWrite(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := NewConcurrent()
+	router.Get("/user/:id", handle)
+	rs := router.getRoutes()
+	if err := router.TryHandle("GET", "/user/:name", handle); err == nil {
+		t.Fatal("conflicting route registered")
+	}
+	if router.getRoutes() != rs {
+		t.Error("routes swapped by failed registration")
+	}
+}
@@ -0,0 +1,338 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+// FileServer serves the files of a file system, as the handle of a route
+// whose path ends with /*filepath.
+//
+// Conditional requests (If-Modified-Since, If-None-Match with the ETag set by
+// the file server) and Range requests are supported. If a file or directory
+// can't be served, the error is returned as a httperror with the status code
+// 404 or 403, instead of writing an error page.
+type FileServer struct {
+	// Root is the file system the files are served from.
+	Root http.FileSystem
+
+	// If enabled, requests for directories without an index.html fail with
+	// 403, instead of being answered with a listing of the directory.
+	DisableListing bool
+
+	// If enabled, a file is served from its precompressed sibling with the
+	// extension .br or .gz instead, if there is one and the client accepts
+	// the respective encoding.
+	Precompressed bool
+
+	// Fallback is the path of the document served instead of a missing file,
+	// e.g. /index.html of a single-page application, which routes the path
+	// itself. It is only served for GET and HEAD requests for paths that
+	// don't look like a file, whose last segment doesn't contain a '.'.
+	// Requests for missing assets, like /app.js, still fail with 404.
+	Fallback string
+}
+
+// precompressed are the encodings of the precompressed siblings of a file, in
+// the order of preference.
+var precompressed = [...]struct {
+	encoding, ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// ServeFiles serves files from the given file system root.
+// The path must end with "/*filepath", files are then served from the local
+// path /defined/root/dir/*filepath.
+// For example if root is "/etc" and *filepath is "passwd", the local file
+// "/etc/passwd" would be served.
+// Internally a FileServer is used, therefore http.NotFound is never used,
+// a httperror is returned instead.
+// To use the operating system's file system implementation,
+// use http.Dir:
+//
+//	router.ServeFiles("/src/*filepath", http.Dir("/var/www"))
+func (r *Router) ServeFiles(path string, root http.FileSystem) *Route {
+	return r.ServeFilesWith(path, &FileServer{Root: root})
+}
+
+// ServeFilesWith is like ServeFiles, but serves the files with the given
+// FileServer, which allows to configure it.
+func (r *Router) ServeFilesWith(path string, fs *FileServer) *Route {
+	if len(path) < 10 || path[len(path)-10:] != "/*filepath" {
+		panic("path must end with /*filepath in path '" + path + "'")
+	}
+	return r.Get(path, fs.Handle)
+}
+
+// ServeSPA serves a single-page application from the given file system root.
+// Like ServeFiles, but requests for missing files that don't look like a file
+// are served the fallback document, e.g. /index.html, and directories are
+// never listed. The routes registered below the path, like an API, take
+// precedence as usual:
+//
+//	router.ServeSPA("/*filepath", http.Dir("/var/www/app"), "/index.html")
+//	router.Get("/api/users/:id", ShowUser)
+func (r *Router) ServeSPA(path string, root http.FileSystem, fallback string) *Route {
+	return r.ServeFilesWith(path, &FileServer{
+		Root:           root,
+		DisableListing: true,
+		Fallback:       fallback,
+	})
+}
+
+// Handle serves the file named by the filepath parameter.
+func (fs *FileServer) Handle(w http.ResponseWriter, req *http.Request, ps Params) error {
+	return fs.serveFile(w, req, CleanPath(ps.ByName("filepath")))
+}
+
+func (fs *FileServer) serveFile(w http.ResponseWriter, req *http.Request, name string) error {
+	f, err := fs.Root.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) && fs.useFallback(req, name) {
+			return fs.serveFallback(w, req)
+		}
+		return toHTTPError(err)
+	}
+	defer f.Close()
+
+	d, err := f.Stat()
+	if err != nil {
+		return toHTTPError(err)
+	}
+
+	// redirect to the canonical path: / at the end of a directory path,
+	// and no / at the end of a file path
+	urlPath := req.URL.Path
+	if d.IsDir() {
+		if urlPath[len(urlPath)-1] != '/' {
+			return localRedirect(w, req, path.Base(urlPath)+"/")
+		}
+	} else if urlPath[len(urlPath)-1] == '/' {
+		return localRedirect(w, req, "../"+path.Base(urlPath))
+	}
+
+	if d.IsDir() {
+		// use the index.html of the directory, if there is one
+		index := strings.TrimSuffix(name, "/") + "/index.html"
+		if ff, err := fs.Root.Open(index); err == nil {
+			defer ff.Close()
+			if dd, err := ff.Stat(); err == nil && !dd.IsDir() {
+				name, f, d = index, ff, dd
+			}
+		}
+	}
+
+	if d.IsDir() {
+		if fs.DisableListing {
+			return httperror.New(http.StatusForbidden, "directory listing is disabled", false)
+		}
+		if checkIfModifiedSince(req, d.ModTime()) {
+			w.WriteHeader(http.StatusNotModified)
+			return nil
+		}
+		w.Header().Set("Last-Modified", d.ModTime().UTC().Format(http.TimeFormat))
+		return dirList(w, req, f)
+	}
+
+	return fs.serveContent(w, req, name, f, d)
+}
+
+// useFallback reports whether the fallback document is served for the
+// missing file name.
+func (fs *FileServer) useFallback(req *http.Request, name string) bool {
+	return len(fs.Fallback) > 0 && (req.Method == "GET" || req.Method == "HEAD") &&
+		strings.IndexByte(path.Base(name), '.') < 0
+}
+
+func (fs *FileServer) serveFallback(w http.ResponseWriter, req *http.Request) error {
+	name := CleanPath(fs.Fallback)
+	f, err := fs.Root.Open(name)
+	if err != nil {
+		return toHTTPError(err)
+	}
+	defer f.Close()
+
+	d, err := f.Stat()
+	if err != nil {
+		return toHTTPError(err)
+	}
+	if d.IsDir() {
+		return httperror.New(http.StatusNotFound, "file not found", false)
+	}
+	return fs.serveContent(w, req, name, f, d)
+}
+
+// serveContent serves the regular file name, from its precompressed sibling
+// if enabled.
+func (fs *FileServer) serveContent(w http.ResponseWriter, req *http.Request, name string, f http.File, d os.FileInfo) error {
+	var content io.ReadSeeker = f
+	if fs.Precompressed {
+		w.Header().Add("Vary", "Accept-Encoding")
+		if ff, dd, encoding := fs.openPrecompressed(req, name); ff != nil {
+			defer ff.Close()
+			ctype, err := contentType(name, f)
+			if err != nil {
+				return toHTTPError(err)
+			}
+			w.Header().Set("Content-Type", ctype)
+			w.Header().Set("Content-Encoding", encoding)
+			content, d = ff, dd
+		}
+	}
+
+	w.Header().Set("ETag", etag(d))
+	http.ServeContent(w, req, d.Name(), d.ModTime(), content)
+	return nil
+}
+
+// openPrecompressed opens the preferred precompressed sibling of the file
+// name accepted by the client, if there is one.
+func (fs *FileServer) openPrecompressed(req *http.Request, name string) (http.File, os.FileInfo, string) {
+	accept := req.Header.Get("Accept-Encoding")
+	if len(accept) == 0 {
+		return nil, nil, ""
+	}
+	for _, p := range precompressed {
+		if !acceptsEncoding(accept, p.encoding) {
+			continue
+		}
+		f, err := fs.Root.Open(name + p.ext)
+		if err != nil {
+			continue
+		}
+		if d, err := f.Stat(); err == nil && !d.IsDir() {
+			return f, d, p.encoding
+		}
+		f.Close()
+	}
+	return nil, nil, ""
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header accepts the
+// given encoding.
+func acceptsEncoding(accept, encoding string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		part = strings.TrimSpace(part)
+		params := ""
+		if i := strings.IndexByte(part, ';'); i >= 0 {
+			part, params = strings.TrimSpace(part[:i]), part[i+1:]
+		}
+		if !strings.EqualFold(part, encoding) {
+			continue
+		}
+		params = strings.Replace(params, " ", "", -1)
+		if strings.HasPrefix(params, "q=") {
+			q, err := strconv.ParseFloat(params[2:], 64)
+			return err == nil && q > 0
+		}
+		return true
+	}
+	return false
+}
+
+// contentType returns the content type of the file name, by its extension
+// or, if it is unknown, by sniffing its content.
+func contentType(name string, content io.ReadSeeker) (string, error) {
+	if ctype := mime.TypeByExtension(path.Ext(name)); len(ctype) > 0 {
+		return ctype, nil
+	}
+	var buf [512]byte
+	n, _ := io.ReadFull(content, buf[:])
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// etag derives the entity tag of a file from its modification time and size.
+func etag(d os.FileInfo) string {
+	return `"` + strconv.FormatInt(d.ModTime().UnixNano(), 36) + "-" +
+		strconv.FormatInt(d.Size(), 36) + `"`
+}
+
+// checkIfModifiedSince reports whether the response to a conditional request
+// is 304 Not Modified.
+func checkIfModifiedSince(req *http.Request, modtime time.Time) bool {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return false
+	}
+	ims := req.Header.Get("If-Modified-Since")
+	if len(ims) == 0 || modtime.IsZero() {
+		return false
+	}
+	t, err := http.ParseTime(ims)
+	if err != nil {
+		return false
+	}
+	// The Last-Modified header truncates sub-second precision
+	return !modtime.Truncate(1e9).After(t)
+}
+
+func dirList(w http.ResponseWriter, req *http.Request, f http.File) error {
+	dirs, err := f.Readdir(-1)
+	if err != nil {
+		return httperror.New(http.StatusInternalServerError, "error reading directory", false)
+	}
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].Name() < dirs[j].Name() })
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if req.Method == "HEAD" {
+		return nil
+	}
+	fmt.Fprintf(w, "<pre>\n")
+	for _, d := range dirs {
+		name := d.Name()
+		if d.IsDir() {
+			name += "/"
+		}
+		// name may contain '?' or '#', which must be escaped to remain
+		// part of the URL path, and not indicate the start of a query
+		// string or fragment.
+		u := url.URL{Path: name}
+		fmt.Fprintf(w, "<a href=\"%s\">%s</a>\n", html.EscapeString(u.String()), html.EscapeString(name))
+	}
+	fmt.Fprintf(w, "</pre>\n")
+	return nil
+}
+
+// localRedirect gives a Moved Permanently response. It does not convert
+// relative paths to absolute paths like http.Redirect does.
+func localRedirect(w http.ResponseWriter, req *http.Request, newPath string) error {
+	if q := req.URL.RawQuery; q != "" {
+		newPath += "?" + q
+	}
+	w.Header().Set("Location", newPath)
+	w.WriteHeader(http.StatusMovedPermanently)
+	return nil
+}
+
+// toHTTPError converts the error of a file system into a httperror, hiding
+// the details from the client.
+func toHTTPError(err error) error {
+	if os.IsNotExist(err) {
+		return httperror.New(http.StatusNotFound, "file not found", false)
+	}
+	if os.IsPermission(err) {
+		return httperror.New(http.StatusForbidden, "file access forbidden", false)
+	}
+	return httperror.New(http.StatusInternalServerError, "error opening file", false)
+}
@@ -0,0 +1,22 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package mrouter
+
+import (
+	"io/fs"
+	"net/http"
+)
+
+// ServeFS is like ServeFiles, but serves the files of an fs.FS, such as an
+// embed.FS:
+//
+//	router.ServeFS("/static/*filepath", staticFiles)
+func (r *Router) ServeFS(path string, fsys fs.FS) *Route {
+	return r.ServeFiles(path, http.FS(fsys))
+}
@@ -0,0 +1,29 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.16
+// +build go1.16
+
+package mrouter
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+func TestRouterServeFS(t *testing.T) {
+	router := New()
+	router.ServeFS("/static/*filepath", fstest.MapFS{
+		"css/site.css": {Data: []byte("body {}")},
+	})
+
+	w, err := serveFile(router, "/static/css/site.css", nil)
+	if err != nil || w.Body.String() != "body {}" {
+		t.Errorf("serving file from fs.FS failed: %v, Body=%q", err, w.Body.String())
+	}
+	if _, err := serveFile(router, "/static/nope.css", nil); err == nil {
+		t.Error("serving missing file from fs.FS did not fail")
+	}
+}
@@ -0,0 +1,251 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+// testFiles creates a directory with a few files to be served.
+func testFiles(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "mrouter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"hello.txt":      "hello, world\n",
+		"app.js":         "console.log('hello');\n",
+		"app.js.gz":      "gzip",
+		"app.js.br":      "br",
+		"sub/index.html": "<h1>index</h1>\n",
+		"list/a.txt":     "a",
+		"list/b?.txt":    "b",
+		"list/c/d.txt":   "d",
+		"noext":          "plain text\n",
+		"noext.gz":       "gzip",
+	}
+	for name, content := range files {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func serveFile(router *Router, path string, header http.Header) (*httptest.ResponseRecorder, error) {
+	r, _ := http.NewRequest("GET", path, nil)
+	for k, v := range header {
+		r.Header[k] = v
+	}
+	w := httptest.NewRecorder()
+	return w, router.ServeHTTP(w, r)
+}
+
+func TestRouterServeFiles(t *testing.T) {
+	router := New()
+	mfs := &mockFileSystem{}
+
+	recv := catchPanic(func() {
+		router.ServeFiles("/noFilepath", mfs)
+	})
+	if recv == nil {
+		t.Fatal("registering path not ending with '*filepath' did not panic")
+	}
+
+	router.ServeFiles("/*filepath", mfs)
+	_, err := serveFile(router, "/favicon.ico", nil)
+	if !mfs.opened {
+		t.Error("serving file failed")
+	}
+	if e, ok := err.(httperror.HttpError); !ok || e.Code() != http.StatusInternalServerError {
+		t.Errorf("wrong error for a failing file system: %v", err)
+	}
+}
+
+func TestFileServer(t *testing.T) {
+	dir := testFiles(t)
+	defer os.RemoveAll(dir)
+
+	router := New()
+	router.ServeFiles("/files/*filepath", http.Dir(dir))
+
+	w, err := serveFile(router, "/files/hello.txt", nil)
+	if err != nil || w.Code != http.StatusOK || w.Body.String() != "hello, world\n" {
+		t.Fatalf("serving file failed: %v, Code=%d, Body=%q", err, w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("wrong content type: %s", ct)
+	}
+	etag := w.Header().Get("ETag")
+	lastModified := w.Header().Get("Last-Modified")
+	if len(etag) == 0 || len(lastModified) == 0 {
+		t.Fatalf("validators not set: ETag=%q, Last-Modified=%q", etag, lastModified)
+	}
+
+	// conditional requests
+	w, _ = serveFile(router, "/files/hello.txt", http.Header{"If-None-Match": {etag}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-None-Match not handled: Code=%d", w.Code)
+	}
+	w, _ = serveFile(router, "/files/hello.txt", http.Header{"If-Modified-Since": {lastModified}})
+	if w.Code != http.StatusNotModified {
+		t.Errorf("If-Modified-Since not handled: Code=%d", w.Code)
+	}
+	past := time.Unix(0, 0).UTC().Format(http.TimeFormat)
+	w, _ = serveFile(router, "/files/hello.txt", http.Header{"If-Modified-Since": {past}})
+	if w.Code != http.StatusOK {
+		t.Errorf("If-Modified-Since not handled: Code=%d", w.Code)
+	}
+
+	// range requests
+	w, _ = serveFile(router, "/files/hello.txt", http.Header{"Range": {"bytes=7-11"}})
+	if w.Code != http.StatusPartialContent || w.Body.String() != "world" {
+		t.Errorf("Range not handled: Code=%d, Body=%q", w.Code, w.Body.String())
+	}
+
+	// errors are returned, not written
+	for _, path := range [...]string{"/files/nope.txt", "/files/../../etc/passwd"} {
+		w, err = serveFile(router, path, nil)
+		if e, ok := err.(httperror.HttpError); !ok || e.Code() != http.StatusNotFound || w.Body.Len() > 0 {
+			t.Errorf("wrong error for %s: %v, Body=%q", path, err, w.Body.String())
+		}
+	}
+
+	// directories
+	w, err = serveFile(router, "/files/sub/", nil)
+	if err != nil || w.Body.String() != "<h1>index</h1>\n" {
+		t.Errorf("serving index.html failed: %v, Body=%q", err, w.Body.String())
+	}
+	w, _ = serveFile(router, "/files/sub", nil)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "sub/" {
+		t.Errorf("directory without trailing slash not redirected: Code=%d, Header=%v", w.Code, w.Header())
+	}
+	w, _ = serveFile(router, "/files/hello.txt/", nil)
+	if w.Code != http.StatusMovedPermanently || w.Header().Get("Location") != "../hello.txt" {
+		t.Errorf("file with trailing slash not redirected: Code=%d, Header=%v", w.Code, w.Header())
+	}
+	w, err = serveFile(router, "/files/list/", nil)
+	if body := w.Body.String(); err != nil ||
+		!strings.Contains(body, `<a href="a.txt">a.txt</a>`) ||
+		!strings.Contains(body, `<a href="b%3F.txt">b?.txt</a>`) ||
+		!strings.Contains(body, `<a href="c/">c/</a>`) {
+		t.Errorf("wrong directory listing: %v, Body=%q", err, body)
+	}
+
+	router = New()
+	router.ServeFilesWith("/files/*filepath", &FileServer{Root: http.Dir(dir), DisableListing: true})
+	w, err = serveFile(router, "/files/list/", nil)
+	if e, ok := err.(httperror.HttpError); !ok || e.Code() != http.StatusForbidden || w.Body.Len() > 0 {
+		t.Errorf("directory listed although disabled: %v, Body=%q", err, w.Body.String())
+	}
+	if w, err = serveFile(router, "/files/sub/", nil); err != nil || w.Code != http.StatusOK {
+		t.Errorf("serving index.html with listing disabled failed: %v", err)
+	}
+}
+
+func TestFileServerPrecompressed(t *testing.T) {
+	dir := testFiles(t)
+	defer os.RemoveAll(dir)
+
+	router := New()
+	router.ServeFilesWith("/*filepath", &FileServer{Root: http.Dir(dir), Precompressed: true})
+
+	tests := []struct {
+		path, accept, encoding, body string
+	}{
+		{"/app.js", "", "", "console.log('hello');\n"},
+		{"/app.js", "gzip, deflate", "gzip", "gzip"},
+		{"/app.js", "gzip, br", "br", "br"},
+		{"/app.js", "br;q=0, gzip", "gzip", "gzip"},
+		{"/app.js", "identity", "", "console.log('hello');\n"},
+		{"/hello.txt", "gzip, br", "", "hello, world\n"},
+		{"/noext", "gzip", "gzip", "gzip"},
+	}
+	for _, test := range tests {
+		w, err := serveFile(router, test.path, http.Header{"Accept-Encoding": {test.accept}})
+		if err != nil || w.Body.String() != test.body {
+			t.Errorf("serving %s for %q failed: %v, Body=%q", test.path, test.accept, err, w.Body.String())
+		}
+		if enc := w.Header().Get("Content-Encoding"); enc != test.encoding {
+			t.Errorf("wrong encoding of %s for %q: want %q, got %q", test.path, test.accept, test.encoding, enc)
+		}
+		if w.Header().Get("Vary") != "Accept-Encoding" {
+			t.Errorf("Vary header not set for %s", test.path)
+		}
+	}
+
+	// the content type is the one of the original file
+	w, _ := serveFile(router, "/app.js", http.Header{"Accept-Encoding": {"gzip"}})
+	if ct := w.Header().Get("Content-Type"); !strings.Contains(ct, "javascript") {
+		t.Errorf("wrong content type of precompressed file: %s", ct)
+	}
+	w, _ = serveFile(router, "/noext", http.Header{"Accept-Encoding": {"gzip"}})
+	if ct := w.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("wrong sniffed content type of precompressed file: %s", ct)
+	}
+}
+
+func TestFileServerFallback(t *testing.T) {
+	dir := testFiles(t)
+	defer os.RemoveAll(dir)
+
+	var api bool
+	router := New()
+	router.ServeSPA("/*filepath", http.Dir(dir), "/sub/index.html")
+	router.Get("/api/users/:id", func(_ http.ResponseWriter, _ *http.Request, _ Params) error {
+		api = true
+		return nil
+	})
+
+	const index = "<h1>index</h1>\n"
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/hello.txt", http.StatusOK, "hello, world\n"},
+		{"/users/gopher", http.StatusOK, index},
+		{"/settings", http.StatusOK, index},
+		{"/missing.js", http.StatusNotFound, ""},
+		{"/assets/logo.png", http.StatusNotFound, ""},
+		{"/list/", http.StatusForbidden, ""},
+	}
+	for _, test := range tests {
+		w, err := serveFile(router, test.path, nil)
+		code := w.Code
+		if e, ok := err.(httperror.HttpError); ok {
+			code = e.Code()
+		}
+		if code != test.code || w.Body.String() != test.body {
+			t.Errorf("wrong response for %s: want %d %q, got %d %q (%v)",
+				test.path, test.code, test.body, code, w.Body.String(), err)
+		}
+	}
+
+	if w, err := serveFile(router, "/api/users/1", nil); err != nil || !api || w.Body.Len() > 0 {
+		t.Errorf("route below the files not matched: %v", err)
+	}
+
+	// other methods don't get the fallback document
+	router.Post("/*filepath", (&FileServer{Root: http.Dir(dir), Fallback: "/sub/index.html"}).Handle)
+	r, _ := http.NewRequest("POST", "/users/gopher", nil)
+	if e, ok := router.ServeHTTP(httptest.NewRecorder(), r).(httperror.HttpError); !ok || e.Code() != http.StatusNotFound {
+		t.Error("fallback document served for a POST request")
+	}
+}
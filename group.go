@@ -0,0 +1,136 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+
+	"github.com/prasannavl/mchain"
+)
+
+// Group is a set of routes that share a common path prefix and a common
+// middleware stack. Routes registered through a Group are added directly to
+// the trees of the Router it was created from, so looking them up costs
+// exactly the same as looking up routes registered on the Router itself.
+type Group struct {
+	router     *Router
+	prefix     string
+	middleware []func(Handle) Handle
+}
+
+// Group returns a new route group. Every path registered through the group
+// is prefixed with prefix, and every handle is wrapped with the given
+// middleware, the first one being the outermost.
+func (r *Router) Group(prefix string, mw ...func(Handle) Handle) *Group {
+	return newGroup(r, "", nil, prefix, mw)
+}
+
+// Group returns a new route group nested in g. The prefix is appended to the
+// prefix of g and the middleware is run inside the middleware of g.
+func (g *Group) Group(prefix string, mw ...func(Handle) Handle) *Group {
+	return newGroup(g.router, g.prefix, g.middleware, prefix, mw)
+}
+
+func newGroup(r *Router, parentPrefix string, parentMw []func(Handle) Handle, prefix string, mw []func(Handle) Handle) *Group {
+	if len(prefix) == 0 || prefix[0] != '/' {
+		panic("group prefix must begin with '/' in prefix '" + prefix + "'")
+	}
+	// The trailing slash belongs to the paths registered in the group
+	if prefix[len(prefix)-1] == '/' {
+		prefix = prefix[:len(prefix)-1]
+	}
+
+	middleware := make([]func(Handle) Handle, 0, len(parentMw)+len(mw))
+	middleware = append(middleware, parentMw...)
+	middleware = append(middleware, mw...)
+
+	return &Group{
+		router:     r,
+		prefix:     parentPrefix + prefix,
+		middleware: middleware,
+	}
+}
+
+// Get is a shortcut for group.Handle("GET", path, handle)
+func (g *Group) Get(path string, handle Handle) *Route {
+	return g.Handle("GET", path, handle)
+}
+
+// Head is a shortcut for group.Handle("HEAD", path, handle)
+func (g *Group) Head(path string, handle Handle) *Route {
+	return g.Handle("HEAD", path, handle)
+}
+
+// Options is a shortcut for group.Handle("OPTIONS", path, handle)
+func (g *Group) Options(path string, handle Handle) *Route {
+	return g.Handle("OPTIONS", path, handle)
+}
+
+// Post is a shortcut for group.Handle("POST", path, handle)
+func (g *Group) Post(path string, handle Handle) *Route {
+	return g.Handle("POST", path, handle)
+}
+
+// Put is a shortcut for group.Handle("PUT", path, handle)
+func (g *Group) Put(path string, handle Handle) *Route {
+	return g.Handle("PUT", path, handle)
+}
+
+// Patch is a shortcut for group.Handle("PATCH", path, handle)
+func (g *Group) Patch(path string, handle Handle) *Route {
+	return g.Handle("PATCH", path, handle)
+}
+
+// Delete is a shortcut for group.Handle("DELETE", path, handle)
+func (g *Group) Delete(path string, handle Handle) *Route {
+	return g.Handle("DELETE", path, handle)
+}
+
+// Any is a shortcut for group.Handle(MethodAny, path, handle)
+func (g *Group) Any(path string, handle Handle) *Route {
+	return g.Handle(MethodAny, path, handle)
+}
+
+// HandleMethods registers the request handle with the given path relative to
+// the group prefix for each of the methods, like Router.HandleMethods.
+func (g *Group) HandleMethods(methods []string, path string, handle Handle) []*Route {
+	routes := make([]*Route, len(methods))
+	for i, method := range methods {
+		routes[i] = g.Handle(method, path, handle)
+	}
+	return routes
+}
+
+// Handle registers a new request handle with the given method and the path
+// relative to the group prefix. The handle is wrapped with the middleware of
+// the group once, at registration time. It returns the registered route.
+func (g *Group) Handle(method, path string, handle Handle) *Route {
+	if len(path) == 0 || path[0] != '/' {
+		panic("path must begin with '/' in path '" + path + "'")
+	}
+
+	for i := len(g.middleware) - 1; i >= 0; i-- {
+		handle = g.middleware[i](handle)
+	}
+
+	return g.router.Handle(method, g.prefix+path, handle)
+}
+
+// Handler is an adapter which allows the usage of an mchain.Handler as a
+// request handle in the group.
+func (g *Group) Handler(method, path string, handler mchain.Handler) *Route {
+	return g.Handle(method, path,
+		func(w http.ResponseWriter, req *http.Request, _ Params) error {
+			return handler.ServeHTTP(w, req)
+		},
+	)
+}
+
+// HandlerFunc is an adapter which allows the usage of an mchain.HandlerFunc as
+// a request handle in the group.
+func (g *Group) HandlerFunc(method, path string, handler mchain.HandlerFunc) *Route {
+	return g.Handler(method, path, handler)
+}
@@ -0,0 +1,153 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	var trace []string
+	mw := func(name string) func(Handle) Handle {
+		return func(next Handle) Handle {
+			return func(w http.ResponseWriter, r *http.Request, ps Params) error {
+				trace = append(trace, name)
+				return next(w, r, ps)
+			}
+		}
+	}
+
+	router := New()
+	api := router.Group("/api/", mw("api"))
+	v1 := api.Group("/v1", mw("v1"))
+
+	var user string
+	v1.Get("/users/:id", func(w http.ResponseWriter, r *http.Request, ps Params) error {
+		trace = append(trace, "handle")
+		user = ps.ByName("id")
+		return nil
+	})
+	api.Post("/ping", func(w http.ResponseWriter, r *http.Request, _ Params) error {
+		trace = append(trace, "ping")
+		return nil
+	})
+
+	w := new(mockResponseWriter)
+
+	r, _ := http.NewRequest("GET", "/api/v1/users/gopher", nil)
+	if err := router.ServeHTTP(w, r); err != nil {
+		t.Fatalf("routing group route failed: %v", err)
+	}
+	if user != "gopher" {
+		t.Errorf("wrong wildcard value: want gopher, got %s", user)
+	}
+	if want := []string{"api", "v1", "handle"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("wrong middleware order: want %v, got %v", want, trace)
+	}
+
+	trace = nil
+	r, _ = http.NewRequest("POST", "/api/ping", nil)
+	router.ServeHTTP(w, r)
+	if want := []string{"api", "ping"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("nested middleware leaked into parent group: want %v, got %v", want, trace)
+	}
+
+	// Group routes are stored in the router's own trees
+	if handle, _, _ := router.Lookup("GET", "/api/v1/users/gopher"); handle == nil {
+		t.Error("group route not found through router lookup")
+	}
+}
+
+func TestGroupAPI(t *testing.T) {
+	var get, head, options, post, put, patch, delete, anyMethod, methods, handler, handlerFunc bool
+
+	httpHandler := handlerStruct{&handler}
+
+	router := New()
+	g := router.Group("/g")
+	g.Get("/GET", func(w http.ResponseWriter, r *http.Request, _ Params) error {
+		get = true
+		return nil
+	})
+	g.Head("/GET", func(w http.ResponseWriter, r *http.Request, _ Params) error {
+		head = true
+		return nil
+	})
+	g.Options("/GET", func(w http.ResponseWriter, r *http.Request, _ Params) error {
+		options = true
+		return nil
+	})
+	g.Post("/POST", func(w http.ResponseWriter, r *http.Request, _ Params) error {
+		post = true
+		return nil
+	})
+	g.Put("/PUT", func(w http.ResponseWriter, r *http.Request, _ Params) error {
+		put = true
+		return nil
+	})
+	g.Patch("/PATCH", func(w http.ResponseWriter, r *http.Request, _ Params) error {
+		patch = true
+		return nil
+	})
+	g.Delete("/DELETE", func(w http.ResponseWriter, r *http.Request, _ Params) error {
+		delete = true
+		return nil
+	})
+	g.Any("/ANY", func(w http.ResponseWriter, r *http.Request, _ Params) error {
+		anyMethod = true
+		return nil
+	})
+	g.HandleMethods([]string{"GET", "PURGE"}, "/METHODS", func(w http.ResponseWriter, r *http.Request, _ Params) error {
+		methods = true
+		return nil
+	})
+	g.Handler("GET", "/Handler", httpHandler)
+	g.HandlerFunc("GET", "/HandlerFunc", func(w http.ResponseWriter, r *http.Request) error {
+		handlerFunc = true
+		return nil
+	})
+
+	w := new(mockResponseWriter)
+
+	requests := []struct {
+		method, path string
+		routed       *bool
+	}{
+		{"GET", "/g/GET", &get},
+		{"HEAD", "/g/GET", &head},
+		{"OPTIONS", "/g/GET", &options},
+		{"POST", "/g/POST", &post},
+		{"PUT", "/g/PUT", &put},
+		{"PATCH", "/g/PATCH", &patch},
+		{"DELETE", "/g/DELETE", &delete},
+		{"LINK", "/g/ANY", &anyMethod},
+		{"PURGE", "/g/METHODS", &methods},
+		{"GET", "/g/Handler", &handler},
+		{"GET", "/g/HandlerFunc", &handlerFunc},
+	}
+	for _, request := range requests {
+		r, _ := http.NewRequest(request.method, request.path, nil)
+		router.ServeHTTP(w, r)
+		if !*request.routed {
+			t.Errorf("routing %s %s failed", request.method, request.path)
+		}
+	}
+}
+
+func TestGroupInvalidPath(t *testing.T) {
+	router := New()
+
+	if recv := catchPanic(func() { router.Group("api") }); recv == nil {
+		t.Error("group prefix not beginning with '/' did not panic")
+	}
+
+	g := router.Group("/api")
+	if recv := catchPanic(func() { g.Get("users", nil) }); recv == nil {
+		t.Error("group path not beginning with '/' did not panic")
+	}
+}
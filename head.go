@@ -0,0 +1,96 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"strconv"
+)
+
+// lookupHead looks up the GET route serving a HEAD request for the path, see
+// Router.HandleHead, like routes.lookup. The TSR recommendation is the one of
+// the GET routes, so that HEAD requests are redirected like GET requests.
+func (rs *routes) lookupHead(path string, p Params) (handle Handle, ps Params, pattern string, tsr bool) {
+	return rs.lookup("GET", path, p)
+}
+
+// headWriter is the http.ResponseWriter of a GET route serving a HEAD request.
+// It discards the body, but holds back the header until the handle returns,
+// so that the Content-Length of the body can still be set.
+type headWriter struct {
+	http.ResponseWriter
+	code    int
+	written int64
+	sent    bool
+}
+
+func (w *headWriter) WriteHeader(code int) {
+	if w.code != 0 {
+		return
+	}
+	// informational replies, like 103 Early Hints, precede the final one and
+	// are sent right away, as net/http does
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(code)
+		return
+	}
+	w.code = code
+}
+
+func (w *headWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	w.written += int64(len(p))
+	return len(p), nil
+}
+
+// Flush sends the header, which then can't carry the Content-Length anymore,
+// and flushes the underlying writer, if it can.
+func (w *headWriter) Flush() {
+	w.sendHeader()
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap returns the underlying writer, so that http.ResponseController can
+// reach the features headWriter doesn't provide itself.
+func (w *headWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *headWriter) sendHeader() {
+	if w.sent || w.code == 0 {
+		return
+	}
+	w.sent = true
+	w.ResponseWriter.WriteHeader(w.code)
+}
+
+// finish sends the header once the handle returned, with the Content-Length
+// of the discarded body, unless the handle declared it. If the handle wrote
+// nothing at all, e.g. since it returned an error, nothing is sent.
+func (w *headWriter) finish() {
+	if !w.sent && w.written > 0 && bodyAllowedForStatus(w.code) {
+		if h := w.Header(); len(h.Get("Content-Length")) == 0 {
+			h.Set("Content-Length", strconv.FormatInt(w.written, 10))
+		}
+	}
+	w.sendHeader()
+}
+
+// bodyAllowedForStatus reports whether a response with the status code may
+// have a body, like the function of net/http.
+func bodyAllowedForStatus(code int) bool {
+	switch {
+	case code >= 100 && code < 200:
+		return false
+	case code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
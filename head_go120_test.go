@@ -0,0 +1,54 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.20
+// +build go1.20
+
+package mrouter
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// deadlineRecorder is a http.ResponseRecorder supporting write deadlines.
+type deadlineRecorder struct {
+	*httptest.ResponseRecorder
+	deadline time.Time
+}
+
+func (w *deadlineRecorder) SetWriteDeadline(deadline time.Time) error {
+	w.deadline = deadline
+	return nil
+}
+
+func TestRouterHandleHeadResponseController(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	var deadlineErr, flushErr error
+	router := New()
+	router.HandleHead = true
+	router.Get("/stream", func(w http.ResponseWriter, _ *http.Request, _ Params) error {
+		rc := http.NewResponseController(w)
+		deadlineErr = rc.SetWriteDeadline(deadline)
+		io.WriteString(w, "chunk")
+		flushErr = rc.Flush()
+		return nil
+	})
+
+	r, _ := http.NewRequest("HEAD", "/stream", nil)
+	w := &deadlineRecorder{ResponseRecorder: httptest.NewRecorder()}
+	if err := router.ServeHTTP(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if deadlineErr != nil || !w.deadline.Equal(deadline) {
+		t.Errorf("write deadline did not reach the writer: %v", deadlineErr)
+	}
+	if flushErr != nil || !w.Flushed || w.Body.Len() != 0 {
+		t.Errorf("wrong flush of a HEAD reply: %v %v %q", flushErr, w.Flushed, w.Body.String())
+	}
+}
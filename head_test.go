@@ -0,0 +1,203 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestRouterHandleHead(t *testing.T) {
+	var method string
+	router := New()
+	router.HandleHead = true
+	router.Get("/user/:name", func(w http.ResponseWriter, r *http.Request, ps Params) error {
+		method = r.Method
+		w.Header().Set("X-User", ps.ByName("name"))
+		io.WriteString(w, "hello ")
+		io.WriteString(w, ps.ByName("name"))
+		return nil
+	})
+	router.Get("/sized", func(w http.ResponseWriter, _ *http.Request, _ Params) error {
+		w.Header().Set("Content-Length", "1000")
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, "partial")
+		return nil
+	})
+	router.Get("/empty", func(w http.ResponseWriter, _ *http.Request, _ Params) error {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	})
+	router.Get("/fail", func(w http.ResponseWriter, _ *http.Request, _ Params) error {
+		return errors.New("failed")
+	})
+	router.Get("/own", func(w http.ResponseWriter, _ *http.Request, _ Params) error {
+		io.WriteString(w, "get")
+		return nil
+	})
+	router.Head("/own", func(w http.ResponseWriter, _ *http.Request, _ Params) error {
+		w.Header().Set("X-Head", "own")
+		return nil
+	})
+
+	r, _ := http.NewRequest("HEAD", "/user/gopher", nil)
+	w := httptest.NewRecorder()
+	if err := router.ServeHTTP(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if method != "HEAD" {
+		t.Errorf("GET route was not called for HEAD: %q", method)
+	}
+	if w.Code != http.StatusOK || w.Body.Len() != 0 {
+		t.Errorf("wrong HEAD reply: %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Content-Length") != "12" || w.Header().Get("X-User") != "gopher" {
+		t.Errorf("wrong HEAD header: %v", w.Header())
+	}
+
+	tests := []struct {
+		path   string
+		code   int
+		length string
+		err    bool
+	}{
+		{"/sized", http.StatusAccepted, "1000", false},
+		{"/empty", http.StatusNoContent, "", false},
+		{"/fail", http.StatusOK, "", true},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("HEAD", test.path, nil)
+		w := httptest.NewRecorder()
+		err := router.ServeHTTP(w, r)
+		if (err != nil) != test.err {
+			t.Errorf("wrong error for %s: %v", test.path, err)
+		}
+		if w.Code != test.code || w.Header().Get("Content-Length") != test.length || w.Body.Len() != 0 {
+			t.Errorf("wrong HEAD reply for %s: %d %v %q", test.path, w.Code, w.Header(), w.Body.String())
+		}
+		if test.err && len(w.Header()) != 0 {
+			t.Errorf("header of failed HEAD request was sent: %v", w.Header())
+		}
+	}
+
+	// routes for HEAD take precedence
+	r, _ = http.NewRequest("HEAD", "/own", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Header().Get("X-Head") != "own" || w.Body.Len() != 0 {
+		t.Errorf("HEAD route was not used: %v", w.Header())
+	}
+
+	// HEAD is allowed wherever GET is
+	r, _ = http.NewRequest("OPTIONS", "/user/gopher", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("wrong Allow header: %q", allow)
+	}
+	r, _ = http.NewRequest("DELETE", "/own", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); w.Code != http.StatusMethodNotAllowed || allow != "GET, HEAD, OPTIONS" {
+		t.Errorf("wrong 405 reply: %d %q", w.Code, allow)
+	}
+
+	// unless disabled
+	router.HandleHead = false
+	r, _ = http.NewRequest("HEAD", "/user/gopher", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "GET, OPTIONS" {
+		t.Errorf("HEAD served without HandleHead: %d %v", w.Code, w.Header())
+	}
+}
+
+func TestRouterHandleHeadRedirect(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	for _, unified := range [...]bool{false, true} {
+		router := New()
+		router.UnifiedTree = unified
+		router.HandleHead = true
+		router.Get("/foo", handle)
+		router.Get("/user/:name/", handle)
+		router.Post("/form", handle)
+
+		// HEAD requests are redirected like GET requests, both to add or
+		// remove a trailing slash and to fix the path
+		for _, path := range [...]string{"/foo/", "/FOO", "/user/gopher", "/USER/gopher"} {
+			get, _ := http.NewRequest("GET", path, nil)
+			gw := httptest.NewRecorder()
+			router.ServeHTTP(gw, get)
+
+			head, _ := http.NewRequest("HEAD", path, nil)
+			hw := httptest.NewRecorder()
+			router.ServeHTTP(hw, head)
+			if gw.Code != http.StatusPermanentRedirect || hw.Code != gw.Code ||
+				hw.Header().Get("Location") != gw.Header().Get("Location") {
+				t.Errorf("wrong HEAD redirect of %s (unified %v): want %d %q, got %d %q", path, unified,
+					gw.Code, gw.Header().Get("Location"), hw.Code, hw.Header().Get("Location"))
+			}
+		}
+
+		// but not to the paths of other methods
+		r, _ := http.NewRequest("HEAD", "/FORM", nil)
+		w := httptest.NewRecorder()
+		if err := router.ServeHTTP(w, r); w.Code == http.StatusPermanentRedirect || err == nil {
+			t.Errorf("HEAD request redirected to a POST route (unified %v): %d %v", unified, w.Code, w.Header())
+		}
+
+		// nor without HandleHead
+		router.HandleHead = false
+		r, _ = http.NewRequest("HEAD", "/foo/", nil)
+		w = httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		if w.Code == http.StatusPermanentRedirect {
+			t.Errorf("HEAD request redirected without HandleHead (unified %v): %v", unified, w.Header())
+		}
+	}
+}
+
+// codeRecorder is a http.ResponseRecorder recording every status code.
+type codeRecorder struct {
+	*httptest.ResponseRecorder
+	codes []int
+}
+
+func (w *codeRecorder) WriteHeader(code int) {
+	w.codes = append(w.codes, code)
+	w.ResponseRecorder.WriteHeader(code)
+}
+
+func TestHeadWriterInformational(t *testing.T) {
+	rec := &codeRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w := &headWriter{ResponseWriter: rec}
+	w.WriteHeader(103) // Early Hints
+	io.WriteString(w, "body")
+	w.finish()
+	if !reflect.DeepEqual(rec.codes, []int{103, http.StatusOK}) || rec.Header().Get("Content-Length") != "4" {
+		t.Errorf("wrong reply after an informational status: %v %v", rec.codes, rec.Header())
+	}
+}
+
+func TestHeadWriterFlush(t *testing.T) {
+	rec := httptest.NewRecorder()
+	w := &headWriter{ResponseWriter: rec}
+	io.WriteString(w, "chunk")
+	w.Flush()
+	if !rec.Flushed || rec.Code != http.StatusOK {
+		t.Errorf("flush did not send the header: %d %v", rec.Code, rec.Flushed)
+	}
+	io.WriteString(w, "more")
+	w.finish()
+	if len(rec.Header().Get("Content-Length")) > 0 || rec.Body.Len() != 0 {
+		t.Errorf("wrong reply after flush: %v %q", rec.Header(), rec.Body.String())
+	}
+}
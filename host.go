@@ -0,0 +1,138 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import "strings"
+
+// hostRouter is a sub-router serving the requests for the hosts matching the
+// pattern.
+type hostRouter struct {
+	pattern string
+	// labels of the pattern, from left to right
+	labels []string
+	// wildcard is set if any label is a named parameter
+	wildcard bool
+	router   *Router
+}
+
+// Host returns the sub-router for the requests to the hosts matching the given
+// pattern, which is created on the first call. Routes registered on the
+// sub-router are matched only against requests to these hosts, and the other
+// routes of r only against requests to other hosts.
+//
+// The pattern is a domain name, e.g. api.example.com, whose labels can be
+// named parameters, e.g. :tenant.example.com. The values of the parameters are
+// appended to the Params of the matched route. Hosts are matched
+// case-insensitively, ignoring the port. Patterns without parameters take
+// precedence, the others are tried in the order they were added.
+//
+// The requests are served by r, with the options and middleware of r; the ones
+// of the sub-router are ignored. Unlike routes, hosts can't be added while
+// serving requests.
+func (r *Router) Host(pattern string) *Router {
+	for _, h := range r.hosts {
+		if strings.EqualFold(h.pattern, pattern) {
+			return h.router
+		}
+	}
+
+	h := &hostRouter{
+		pattern: pattern,
+		labels:  strings.Split(pattern, "."),
+		router:  New(),
+	}
+	for i, label := range h.labels {
+		if len(label) == 0 {
+			panic("empty label in host pattern '" + pattern + "'")
+		}
+		if label[0] == ':' {
+			if len(label) < 2 {
+				panic("wildcards must be named with a non-empty name in host pattern '" + pattern + "'")
+			}
+			h.wildcard = true
+		} else {
+			h.labels[i] = strings.ToLower(label)
+		}
+	}
+	h.router.CopyOnWrite = r.CopyOnWrite
+	h.router.UnifiedTree = r.UnifiedTree
+
+	// keep the patterns without parameters in front
+	pos := len(r.hosts)
+	if !h.wildcard {
+		for pos > 0 && r.hosts[pos-1].wildcard {
+			pos--
+		}
+	}
+	r.hosts = append(r.hosts, nil)
+	copy(r.hosts[pos+1:], r.hosts[pos:])
+	r.hosts[pos] = h
+	return h.router
+}
+
+// lookupHost returns the sub-router for the host of a request, or nil.
+func (r *Router) lookupHost(host string) *hostRouter {
+	host = stripPort(host)
+	for _, h := range r.hosts {
+		if h.match(host) {
+			return h
+		}
+	}
+	return nil
+}
+
+// match reports whether host matches the pattern of h.
+func (h *hostRouter) match(host string) bool {
+	for i, label := range h.labels {
+		end := strings.IndexByte(host, '.')
+		if end < 0 {
+			if i != len(h.labels)-1 {
+				return false
+			}
+			end = len(host)
+		}
+		if end == 0 || (label[0] != ':' && !strings.EqualFold(label, host[:end])) {
+			return false
+		}
+		if end < len(host) {
+			end++
+		}
+		host = host[end:]
+	}
+	return len(host) == 0
+}
+
+// appendParams appends the values of the parameters of the pattern of h to
+// ps. The host must match the pattern.
+func (h *hostRouter) appendParams(host string, ps Params) Params {
+	host = stripPort(host)
+	for _, label := range h.labels {
+		end := strings.IndexByte(host, '.')
+		if end < 0 {
+			end = len(host)
+		}
+		if label[0] == ':' {
+			ps = append(ps, Param{Key: label[1:], Value: host[:end]})
+		}
+		if end < len(host) {
+			end++
+		}
+		host = host[end:]
+	}
+	return ps
+}
+
+// stripPort removes the port and the trailing dot of a fully qualified
+// domain name from a host.
+func stripPort(host string) string {
+	if i := strings.LastIndexByte(host, ':'); i > strings.LastIndexByte(host, ']') {
+		host = host[:i]
+	}
+	if len(host) > 0 && host[len(host)-1] == '.' {
+		host = host[:len(host)-1]
+	}
+	return host
+}
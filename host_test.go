@@ -0,0 +1,116 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+func TestRouterHost(t *testing.T) {
+	var routed string
+	var params Params
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) error {
+			routed, params = name, ps
+			return nil
+		}
+	}
+
+	router := New()
+	router.Get("/user/:name", handle("default"))
+
+	api := router.Host("api.example.com")
+	api.Get("/user/:name", handle("api"))
+	if router.Host("API.example.com") != api {
+		t.Error("host pattern added twice")
+	}
+
+	tenant := router.Host(":tenant.example.com")
+	tenant.Get("/", handle("tenant"))
+	tenant.Get("/user/:name", handle("tenant.user"))
+
+	router.Host(":region.:service.example.org").Get("/", handle("service"))
+
+	tests := []struct {
+		host   string
+		path   string
+		routed string
+		params Params
+	}{
+		{"example.com", "/user/gopher", "default", Params{{"name", "gopher"}}},
+		{"api.example.com", "/user/gopher", "api", Params{{"name", "gopher"}}},
+		{"API.Example.com:8080", "/user/gopher", "api", Params{{"name", "gopher"}}},
+		{"api.example.com.", "/user/gopher", "api", Params{{"name", "gopher"}}},
+		{"acme.example.com", "/", "tenant", Params{{"tenant", "acme"}}},
+		{"acme.example.com", "/user/gopher", "tenant.user", Params{{"name", "gopher"}, {"tenant", "acme"}}},
+		{"eu.db.example.org", "/", "service", Params{{"region", "eu"}, {"service", "db"}}},
+		{"a.b.example.com", "/user/gopher", "default", Params{{"name", "gopher"}}},
+		{"[::1]:8080", "/user/gopher", "default", Params{{"name", "gopher"}}},
+	}
+	for _, test := range tests {
+		routed, params = "", nil
+		r, _ := http.NewRequest("GET", test.path, nil)
+		r.Host = test.host
+		if err := router.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+			t.Errorf("routing %s%s failed: %v", test.host, test.path, err)
+			continue
+		}
+		if routed != test.routed {
+			t.Errorf("wrong route for %s%s: want %s, got %s", test.host, test.path, test.routed, routed)
+		}
+		if !reflect.DeepEqual(params, test.params) {
+			t.Errorf("wrong params for %s%s: want %v, got %v", test.host, test.path, test.params, params)
+		}
+	}
+
+	// the routes of a host are not matched against other hosts, and the
+	// other routes not against the host
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Host = "example.com"
+	if e, ok := router.ServeHTTP(httptest.NewRecorder(), r).(httperror.HttpError); !ok || e.Code() != http.StatusNotFound {
+		t.Error("route of a host matched for another host")
+	}
+	r, _ = http.NewRequest("GET", "/", nil)
+	r.Host = "api.example.com"
+	if e, ok := router.ServeHTTP(httptest.NewRecorder(), r).(httperror.HttpError); !ok || e.Code() != http.StatusNotFound {
+		t.Error("default route matched for a host")
+	}
+}
+
+func TestRouterHostPrecedence(t *testing.T) {
+	var routed string
+	handle := func(name string) Handle {
+		return func(_ http.ResponseWriter, _ *http.Request, ps Params) error {
+			routed = name
+			return nil
+		}
+	}
+
+	router := New()
+	router.Host(":tenant.example.com").Get("/", handle("tenant"))
+	router.Host("www.example.com").Get("/", handle("www"))
+
+	r, _ := http.NewRequest("GET", "/", nil)
+	r.Host = "www.example.com"
+	router.ServeHTTP(httptest.NewRecorder(), r)
+	if routed != "www" {
+		t.Errorf("host pattern with parameters took precedence: %s", routed)
+	}
+}
+
+func TestRouterHostInvalid(t *testing.T) {
+	router := New()
+	for _, pattern := range [...]string{"", "example..com", ".example.com", ":.example.com"} {
+		if recv := catchPanic(func() { router.Host(pattern) }); recv == nil {
+			t.Errorf("invalid host pattern '%s' did not panic", pattern)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+// ParamError is the error returned by the typed accessors of Params, like
+// Params.Int, if the value of a parameter is missing or invalid. It is a
+// httperror.HttpError with the status code 400, so that it can be returned
+// by a handle as it is.
+type ParamError struct {
+	httperror.HttpError
+	// Name is the name of the parameter.
+	Name string
+	// Value is the invalid value, which is empty if it is missing.
+	Value string
+}
+
+func newParamError(name, value, expected string, cause error) error {
+	msg := "invalid value for parameter " + name + ": " + expected + " expected"
+	if len(value) == 0 {
+		msg = "missing value for parameter " + name
+	}
+	return &ParamError{
+		HttpError: httperror.NewWithCause(http.StatusBadRequest, msg, cause, false),
+		Name:      name,
+		Value:     value,
+	}
+}
+
+// Int returns the value of the parameter with the given name as an int. The
+// error is a *ParamError if the value is missing or not a decimal integer.
+func (ps Params) Int(name string) (int, error) {
+	v := ps.ByName(name)
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, newParamError(name, v, "integer", err)
+	}
+	return i, nil
+}
+
+// Int64 is like Int, but returns an int64.
+func (ps Params) Int64(name string) (int64, error) {
+	v := ps.ByName(name)
+	i, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return 0, newParamError(name, v, "integer", err)
+	}
+	return i, nil
+}
+
+// Uint is like Int, but returns a uint, which fails for negative values.
+func (ps Params) Uint(name string) (uint, error) {
+	v := ps.ByName(name)
+	i, err := strconv.ParseUint(v, 10, 0)
+	if err != nil {
+		return 0, newParamError(name, v, "unsigned integer", err)
+	}
+	return uint(i), nil
+}
+
+// Bool returns the value of the parameter with the given name as a bool, as
+// parsed by strconv.ParseBool. The error is a *ParamError if the value is
+// missing or invalid.
+func (ps Params) Bool(name string) (bool, error) {
+	v := ps.ByName(name)
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, newParamError(name, v, "boolean", err)
+	}
+	return b, nil
+}
+
+// Float returns the value of the parameter with the given name as a float64.
+// The error is a *ParamError if the value is missing or not a number.
+func (ps Params) Float(name string) (float64, error) {
+	v := ps.ByName(name)
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return 0, newParamError(name, v, "number", err)
+	}
+	return f, nil
+}
+
+// Time returns the value of the parameter with the given name as a time, as
+// parsed by time.Parse with the layout, e.g. time.RFC3339 or "2006-01-02". The
+// error is a *ParamError if the value is missing or doesn't match the layout.
+func (ps Params) Time(name, layout string) (time.Time, error) {
+	v := ps.ByName(name)
+	t, err := time.Parse(layout, v)
+	if err != nil {
+		return time.Time{}, newParamError(name, v, "time like "+layout, err)
+	}
+	return t, nil
+}
+
+var errInvalidUUID = errors.New("invalid UUID format")
+
+// UUID returns the value of the parameter with the given name as the bytes of
+// a UUID in the canonical form xxxxxxxx-xxxx-xxxx-xxxx-xxxxxxxxxxxx, which
+// can be converted to the UUID types of other packages. The error is a
+// *ParamError if the value is missing or not a UUID.
+func (ps Params) UUID(name string) ([16]byte, error) {
+	var u [16]byte
+	v := ps.ByName(name)
+	if len(v) != 36 || v[8] != '-' || v[13] != '-' || v[18] != '-' || v[23] != '-' {
+		return u, newParamError(name, v, "UUID", errInvalidUUID)
+	}
+	j := 0
+	for i := 0; i < len(v); i += 2 {
+		if v[i] == '-' {
+			i++
+		}
+		hi, ok1 := fromHex(v[i])
+		lo, ok2 := fromHex(v[i+1])
+		if !ok1 || !ok2 {
+			return u, newParamError(name, v, "UUID", errInvalidUUID)
+		}
+		u[j] = hi<<4 | lo
+		j++
+	}
+	return u, nil
+}
+
+func fromHex(c byte) (byte, bool) {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0', true
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10, true
+	case 'A' <= c && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+// Enum returns the value of the parameter with the given name, if it is one of
+// the values. The error is a *ParamError if the value is missing or isn't.
+func (ps Params) Enum(name string, values ...string) (string, error) {
+	v := ps.ByName(name)
+	for _, value := range values {
+		if v == value && len(v) > 0 {
+			return v, nil
+		}
+	}
+	return "", newParamError(name, v, "one of "+strings.Join(values, ", "), nil)
+}
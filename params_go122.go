@@ -0,0 +1,19 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.22
+// +build go1.22
+
+package mrouter
+
+import "net/http"
+
+// setPathValues sets the values of ps as the path values of the request, so
+// that they can be read with http.Request.PathValue.
+func setPathValues(req *http.Request, ps Params) {
+	for _, p := range ps {
+		req.SetPathValue(p.Key, p.Value)
+	}
+}
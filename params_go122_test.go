@@ -0,0 +1,49 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.22
+// +build go1.22
+
+package mrouter
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestRouterAttachParamsPathValue(t *testing.T) {
+	var name, post, tenant string
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		name, post, tenant = r.PathValue("name"), r.PathValue("post"), r.PathValue("tenant")
+		return nil
+	}
+
+	router := New()
+	router.AttachParams = true
+	router.HandlerFunc("GET", "/user/:name/posts/:post", handler)
+	router.Host(":tenant.example.com").HandlerFunc("GET", "/user/:name/posts/:post", handler)
+
+	r, _ := http.NewRequest("GET", "/user/gopher/posts/1", nil)
+	router.ServeHTTP(new(mockResponseWriter), r)
+	if name != "gopher" || post != "1" {
+		t.Errorf("wrong path values: %q %q", name, post)
+	}
+	if len(r.PathValue("name")) > 0 {
+		t.Error("path values set on the request of the caller")
+	}
+
+	r, _ = http.NewRequest("GET", "http://acme.example.com/user/gopher/posts/2", nil)
+	router.ServeHTTP(new(mockResponseWriter), r)
+	if name != "gopher" || post != "2" || tenant != "acme" {
+		t.Errorf("wrong path values with host: %q %q %q", name, post, tenant)
+	}
+
+	router.AttachParams = false
+	r, _ = http.NewRequest("GET", "/user/gopher/posts/3", nil)
+	router.ServeHTTP(new(mockResponseWriter), r)
+	if len(name) > 0 {
+		t.Errorf("path values set without AttachParams: %q", name)
+	}
+}
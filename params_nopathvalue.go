@@ -0,0 +1,15 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build !go1.22
+// +build !go1.22
+
+package mrouter
+
+import "net/http"
+
+// setPathValues does nothing, since path values were added to http.Request
+// in Go 1.22.
+func setPathValues(req *http.Request, ps Params) {}
@@ -0,0 +1,160 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prasannavl/goerror/httperror"
+	"github.com/prasannavl/mchain"
+)
+
+func TestParamsTyped(t *testing.T) {
+	ps := Params{
+		{"int", "-42"},
+		{"uint", "42"},
+		{"big", "9007199254740993"},
+		{"bool", "true"},
+		{"float", "1.5"},
+		{"date", "2017-08-15"},
+		{"uuid", "123E4567-e89b-12d3-a456-426614174000"},
+		{"sort", "desc"},
+		{"word", "gopher"},
+	}
+
+	if i, err := ps.Int("int"); err != nil || i != -42 {
+		t.Errorf("Int: %v %v", i, err)
+	}
+	if i, err := ps.Int64("big"); err != nil || i != 9007199254740993 {
+		t.Errorf("Int64: %v %v", i, err)
+	}
+	if i, err := ps.Uint("uint"); err != nil || i != 42 {
+		t.Errorf("Uint: %v %v", i, err)
+	}
+	if b, err := ps.Bool("bool"); err != nil || !b {
+		t.Errorf("Bool: %v %v", b, err)
+	}
+	if f, err := ps.Float("float"); err != nil || f != 1.5 {
+		t.Errorf("Float: %v %v", f, err)
+	}
+	if d, err := ps.Time("date", "2006-01-02"); err != nil || !d.Equal(time.Date(2017, 8, 15, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("Time: %v %v", d, err)
+	}
+	want := [16]byte{0x12, 0x3e, 0x45, 0x67, 0xe8, 0x9b, 0x12, 0xd3, 0xa4, 0x56, 0x42, 0x66, 0x14, 0x17, 0x40, 0x00}
+	if u, err := ps.UUID("uuid"); err != nil || u != want {
+		t.Errorf("UUID: %x %v", u, err)
+	}
+	if v, err := ps.Enum("sort", "asc", "desc"); err != nil || v != "desc" {
+		t.Errorf("Enum: %v %v", v, err)
+	}
+
+	failures := []struct {
+		name  string
+		value string
+		get   func() error
+	}{
+		{"Int", "gopher", func() error { _, err := ps.Int("word"); return err }},
+		{"Int64", "gopher", func() error { _, err := ps.Int64("word"); return err }},
+		{"Uint", "-42", func() error { _, err := ps.Uint("int"); return err }},
+		{"Bool", "gopher", func() error { _, err := ps.Bool("word"); return err }},
+		{"Float", "gopher", func() error { _, err := ps.Float("word"); return err }},
+		{"Time", "1.5", func() error { _, err := ps.Time("float", time.RFC3339); return err }},
+		{"UUID", "gopher", func() error { _, err := ps.UUID("word"); return err }},
+		{"UUID", "123e4567-e89b-12d3-a456-42661417400g", func() error {
+			_, err := Params{{"uuid", "123e4567-e89b-12d3-a456-42661417400g"}}.UUID("uuid")
+			return err
+		}},
+		{"Enum", "gopher", func() error { _, err := ps.Enum("word", "asc", "desc"); return err }},
+		{"missing", "", func() error { _, err := ps.Int("missing"); return err }},
+		{"missing Enum", "", func() error { _, err := ps.Enum("missing", ""); return err }},
+	}
+	for _, test := range failures {
+		err := test.get()
+		e, ok := err.(*ParamError)
+		if !ok {
+			t.Errorf("%s: want a *ParamError, got %v", test.name, err)
+			continue
+		}
+		var he httperror.HttpError = e
+		if he.Code() != http.StatusBadRequest || e.Value != test.value {
+			t.Errorf("%s: wrong error: %d %q", test.name, he.Code(), e.Value)
+		}
+	}
+
+	// the error names the parameter, and keeps the cause
+	_, err := ps.Int("word")
+	e := err.(*ParamError)
+	if e.Name != "word" || e.Error() != "invalid value for parameter word: integer expected" {
+		t.Errorf("wrong error: %q %q", e.Name, e.Error())
+	}
+	if _, ok := e.Cause().(*strconv.NumError); !ok {
+		t.Errorf("wrong cause: %v", e.Cause())
+	}
+}
+
+func TestRouterAttachParams(t *testing.T) {
+	var ps Params
+	var pattern string
+	var ctx context.Context
+	handler := func(w http.ResponseWriter, r *http.Request) error {
+		ctx = r.Context()
+		ps = ParamsFromContext(ctx)
+		pattern = PatternFromContext(ctx)
+		return nil
+	}
+
+	router := New()
+	router.HandlerFunc("GET", "/user/:name/posts/:post", handler)
+	router.HandlerFunc("GET", "/static", handler)
+
+	serve := func(path string) {
+		ps, pattern, ctx = nil, "", nil
+		r, _ := http.NewRequest("GET", path, nil)
+		if err := router.ServeHTTP(new(mockResponseWriter), r); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// disabled by default
+	serve("/user/gopher/posts/1")
+	if ps != nil {
+		t.Errorf("Params attached without AttachParams: %v", ps)
+	}
+
+	router.AttachParams = true
+	want := Params{{"name", "gopher"}, {"post", "1"}}
+	serve("/user/gopher/posts/1")
+	if !reflect.DeepEqual(ps, want) || pattern != "/user/:name/posts/:post" {
+		t.Errorf("wrong attached Params: %v %q", ps, pattern)
+	}
+
+	// requests without parameters are passed as they are
+	serve("/static")
+	if ctx.Value(routeContextKey) != nil {
+		t.Error("route context attached without parameters")
+	}
+
+	// with middleware, the context of the request is passed on
+	var mwCtx context.Context
+	router.Use(func(next mchain.Handler) mchain.Handler {
+		return mchain.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			mwCtx = r.Context()
+			return next.ServeHTTP(w, r)
+		})
+	})
+	serve("/user/gopher/posts/1")
+	if !reflect.DeepEqual(ps, want) {
+		t.Errorf("wrong attached Params with middleware: %v", ps)
+	}
+	if ctx.Value(routeContextKey) != mwCtx.Value(routeContextKey) {
+		t.Error("route context attached twice with middleware")
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+// getParams returns empty Params from the pool of the router, with enough
+// capacity for the values of any route of rs, the parameters of the host and
+// the matched route path, see Router.PoolParams.
+func (r *Router) getParams(rs *routes, host *hostRouter) *Params {
+	n := 1
+	if rs.paths != nil {
+		n += int(rs.paths.maxParams)
+	}
+	if host != nil {
+		n += len(host.labels)
+	}
+
+	pp, _ := r.paramsPool.Get().(*Params)
+	if pp == nil {
+		pp = new(Params)
+	}
+	if cap(*pp) < n {
+		*pp = make(Params, 0, n)
+	}
+	return pp
+}
+
+// putParams puts pp back into the pool of the router, once the request is
+// served. ps are the Params the request was served with, which were appended
+// to *pp, unless there were none.
+func (r *Router) putParams(pp *Params, ps Params) {
+	if cap(ps) > 0 {
+		*pp = ps
+	}
+	// the values are cleared, so that the pool doesn't keep them alive
+	ps = (*pp)[:cap(*pp)]
+	for i := range ps {
+		ps[i] = Param{}
+	}
+	*pp = ps[:0]
+	r.paramsPool.Put(pp)
+}
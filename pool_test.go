@@ -0,0 +1,151 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParamsClone(t *testing.T) {
+	if Params(nil).Clone() != nil {
+		t.Error("clone of nil Params is not nil")
+	}
+	ps := Params{{"name", "gopher"}, {"id", "42"}}
+	clone := ps.Clone()
+	if !reflect.DeepEqual(clone, ps) {
+		t.Errorf("wrong clone: %v", clone)
+	}
+	ps[0].Value = "changed"
+	if clone[0].Value != "gopher" {
+		t.Error("clone shares the values of the Params")
+	}
+}
+
+func TestRouterPoolParams(t *testing.T) {
+	for _, unified := range []bool{false, true} {
+		var got, retained Params
+		handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) error {
+			got = append(Params(nil), ps...)
+			retained = ps.Clone()
+			return nil
+		}
+
+		router := New()
+		router.UnifiedTree = unified
+		router.PoolParams = true
+		router.SaveMatchedRoutePath = true
+		router.Get("/user/:name/posts/:post", handle)
+		router.Get("/src/*filepath", handle)
+		router.Get("/static", handle)
+		router.Host(":tenant.example.com").Get("/user/:name", handle)
+
+		tests := []struct {
+			host, path string
+			ps         Params
+		}{
+			{"", "/user/gopher/posts/1", Params{{"name", "gopher"}, {"post", "1"}, {MatchedRoutePathParam, "/user/:name/posts/:post"}}},
+			{"", "/src/a/b", Params{{"filepath", "/a/b"}, {MatchedRoutePathParam, "/src/*filepath"}}},
+			{"", "/static", Params{{MatchedRoutePathParam, "/static"}}},
+			{"acme.example.com", "/user/gopher", Params{{"name", "gopher"}, {"tenant", "acme"}, {MatchedRoutePathParam, "/user/:name"}}},
+			{"", "/user/gopher/posts/2", Params{{"name", "gopher"}, {"post", "2"}, {MatchedRoutePathParam, "/user/:name/posts/:post"}}},
+		}
+		for _, test := range tests {
+			r, _ := http.NewRequest("GET", test.path, nil)
+			if len(test.host) > 0 {
+				r.Host = test.host
+			}
+			if err := router.ServeHTTP(new(mockResponseWriter), r); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.ps) {
+				t.Errorf("unified %v, %s: want %v, got %v", unified, test.path, test.ps, got)
+			}
+			if !reflect.DeepEqual(retained, test.ps) {
+				t.Errorf("unified %v, %s: cloned Params were modified: %v", unified, test.path, retained)
+			}
+		}
+	}
+}
+
+func TestRouterPoolParamsAllocs(t *testing.T) {
+	var name string
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) error {
+		name = ps.ByName("name")
+		return nil
+	}
+
+	router := New()
+	router.PoolParams = true
+	router.Get("/user/:name/posts/:post", handle)
+	router.Get("/src/*filepath", handle)
+
+	r, _ := http.NewRequest("GET", "/user/gopher/posts/1", nil)
+	w := &headerWriter{header: make(http.Header)}
+	router.ServeHTTP(w, r)
+	allocs := testing.AllocsPerRun(100, func() {
+		router.ServeHTTP(w, r)
+	})
+	if allocs > 0 {
+		t.Errorf("serving a route with parameters allocated %v times", allocs)
+	}
+	if name != "gopher" {
+		t.Errorf("wrong value: %q", name)
+	}
+}
+
+func benchmarkPoolParams(b *testing.B, pool bool, path string) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.PoolParams = pool
+	router.Get("/user/:name/posts/:post", handle)
+	router.Get("/src/*filepath", handle)
+	router.Get("/static", handle)
+
+	r, _ := http.NewRequest("GET", path, nil)
+	w := &headerWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkParams(b *testing.B) {
+	benchmarkPoolParams(b, false, "/user/gopher/posts/1")
+}
+
+func BenchmarkPoolParams(b *testing.B) {
+	benchmarkPoolParams(b, true, "/user/gopher/posts/1")
+}
+
+func BenchmarkPoolParamsCatchAll(b *testing.B) {
+	benchmarkPoolParams(b, true, "/src/a/b/c")
+}
+
+func BenchmarkPoolParamsStatic(b *testing.B) {
+	benchmarkPoolParams(b, true, "/static")
+}
+
+func BenchmarkPoolParamsParallel(b *testing.B) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.PoolParams = true
+	router.Get("/user/:name/posts/:post", handle)
+
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		r, _ := http.NewRequest("GET", "/user/gopher/posts/1", nil)
+		w := &headerWriter{header: make(http.Header)}
+		for pb.Next() {
+			router.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,98 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+// RedirectKind is the kind of a redirect made by the router.
+type RedirectKind int
+
+const (
+	// TrailingSlashRedirect is the redirect to the path with (without) the
+	// trailing slash, see Router.RedirectTrailingSlash.
+	TrailingSlashRedirect RedirectKind = iota + 1
+
+	// FixedPathRedirect is the redirect to the corrected path, see
+	// Router.RedirectFixedPath.
+	FixedPathRedirect
+)
+
+func (k RedirectKind) String() string {
+	switch k {
+	case TrailingSlashRedirect:
+		return "trailing slash"
+	case FixedPathRedirect:
+		return "fixed path"
+	}
+	return "unknown"
+}
+
+// RedirectCodes are the HTTP status codes of a kind of redirect. A zero code
+// means 308 Permanent Redirect.
+type RedirectCodes struct {
+	// Get is the status code for GET and HEAD requests.
+	Get int
+	// Other is the status code for all other request methods.
+	Other int
+}
+
+// MovedRedirectCodes redirects GET and HEAD requests with 301 Moved
+// Permanently and all other requests with 307 Temporary Redirect, which
+// preserves the method and body also for clients that don't know 308.
+var MovedRedirectCodes = RedirectCodes{
+	Get:   http.StatusMovedPermanently,
+	Other: http.StatusTemporaryRedirect,
+}
+
+// code returns the status code for a request with the given method.
+func (c RedirectCodes) code(method string) int {
+	code := c.Other
+	if method == "GET" || method == "HEAD" {
+		code = c.Get
+	}
+	if code == 0 {
+		code = http.StatusPermanentRedirect
+	}
+	return code
+}
+
+// RedirectError is the error returned by the router instead of redirecting,
+// if Router.HandleRedirect is disabled. It is a httperror.HttpError with the
+// status code of the redirect, and the Location header set.
+type RedirectError struct {
+	httperror.HttpError
+	// Location is the URL the request would be redirected to.
+	Location string
+	// Kind is the kind of the redirect.
+	Kind RedirectKind
+}
+
+func handleRedirect(r *Router, w http.ResponseWriter, req *http.Request, url *url.URL, kind RedirectKind) error {
+	codes := r.TrailingSlashRedirectCodes
+	if kind == FixedPathRedirect {
+		codes = r.FixedPathRedirectCodes
+	}
+	code := codes.code(req.Method)
+	location := url.String()
+
+	if r.HandleRedirect {
+		w.Header().Set("Location", location)
+		w.WriteHeader(code)
+		return nil
+	}
+	e := &RedirectError{
+		HttpError: httperror.New(code, "route redirection ("+kind.String()+")", true),
+		Location:  location,
+		Kind:      kind,
+	}
+	e.Headers().Set("Location", location)
+	return e
+}
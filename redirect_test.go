@@ -0,0 +1,86 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prasannavl/goerror/httperror"
+)
+
+func TestRouterRedirectCodes(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.Get("/path", handle)
+	router.Head("/path", handle)
+	router.Post("/path", handle)
+	router.TrailingSlashRedirectCodes = MovedRedirectCodes
+	router.FixedPathRedirectCodes = RedirectCodes{Get: http.StatusFound}
+
+	tests := []struct {
+		method string
+		path   string
+		code   int
+	}{
+		{"GET", "/path/", 301},  // trailing slash
+		{"HEAD", "/path/", 301}, // trailing slash, HEAD like GET
+		{"POST", "/path/", 307}, // trailing slash
+		{"GET", "/PATH", 302},   // fixed path
+		{"POST", "/PATH", 308},  // fixed path, defaults to 308
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest(test.method, test.path, nil)
+		w := httptest.NewRecorder()
+		if err := router.ServeHTTP(w, r); err != nil {
+			t.Errorf("redirect of %s %s failed: %v", test.method, test.path, err)
+			continue
+		}
+		if w.Code != test.code || w.Header().Get("Location") != "/path" {
+			t.Errorf("wrong redirect of %s %s: want %d, got %d %v", test.method, test.path, test.code, w.Code, w.Header())
+		}
+	}
+}
+
+func TestRouterRedirectError(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.HandleRedirect = false
+	router.TrailingSlashRedirectCodes = MovedRedirectCodes
+	router.Get("/path", handle)
+
+	tests := []struct {
+		path string
+		code int
+		kind RedirectKind
+	}{
+		{"/path/", 301, TrailingSlashRedirect},
+		{"/PATH", 308, FixedPathRedirect},
+	}
+	for _, test := range tests {
+		r, _ := http.NewRequest("GET", test.path, nil)
+		w := httptest.NewRecorder()
+		err := router.ServeHTTP(w, r)
+		e, ok := err.(*RedirectError)
+		if !ok {
+			t.Errorf("redirect of %s did not return a *RedirectError: %v", test.path, err)
+			continue
+		}
+		if e.Kind != test.kind || e.Location != "/path" {
+			t.Errorf("wrong redirect error for %s: want %s, got %s to %s", test.path, test.kind, e.Kind, e.Location)
+		}
+		var he httperror.HttpError = e
+		if he.Code() != test.code || he.Headers().Get("Location") != "/path" || !he.End() {
+			t.Errorf("wrong http error for %s: %d %v", test.path, he.Code(), he.Headers())
+		}
+		if w.Code != http.StatusOK || len(w.Header()) != 0 {
+			t.Errorf("redirect of %s was written: %d %v", test.path, w.Code, w.Header())
+		}
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+// Route is a registered route, as returned by the registration functions of
+// the Router. It can be given a name, which allows to build URLs for the route
+// with Router.URL instead of hard-coding them.
+type Route struct {
+	router *Router
+	method string
+	path   string
+	name   string
+}
+
+// RouteInfo describes a registered route, as reported by Router.Routes and
+// Router.Walk.
+type RouteInfo struct {
+	// Host is the pattern of the host the route was registered for with
+	// Router.Host, or empty for the routes of the router itself.
+	Host string
+	// Method is the request method the route was registered for.
+	Method string
+	// Path is the path the route was registered with, e.g. /user/:name.
+	Path string
+	// Name is the name of the route, if it was given one.
+	Name string
+	// Handle is the handle of the route, as it is called by the router,
+	// which includes the middleware of a group.
+	Handle Handle
+}
+
+// Method returns the request method the route was registered for.
+func (rt *Route) Method() string {
+	return rt.method
+}
+
+// Path returns the path the route was registered with, e.g. /user/:name.
+func (rt *Route) Path() string {
+	return rt.path
+}
+
+// Name sets the name of the route, e.g. user.show, which has to be unique
+// within the router. It returns the route, so that it can be used right at
+// registration:
+//
+//	router.Get("/user/:name", ShowUser).Name("user.show")
+//
+// It panics if the route was removed.
+func (rt *Route) Name(name string) *Route {
+	if len(name) == 0 {
+		panic("route name must not be empty for path '" + rt.path + "'")
+	}
+
+	r := rt.router
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	rt.checkRegistered()
+
+	if other := r.names[name]; other != nil && other != rt {
+		panic("route name '" + name + "' is already used by path '" + other.path + "'")
+	}
+	if r.names == nil {
+		r.names = make(map[string]*Route)
+	}
+	if len(rt.name) > 0 {
+		delete(r.names, rt.name)
+	}
+	r.names[name] = rt
+	rt.name = name
+	return rt
+}
+
+// checkRegistered panics if the route was removed. The caller must hold the
+// lock of the router.
+func (rt *Route) checkRegistered() {
+	if !rt.router.getRoutes().has(rt.method, rt.path) {
+		panic("route " + rt.method + " '" + rt.path + "' is not registered")
+	}
+}
+
+// URL builds the path of the route with the given name, substituting its
+// parameters with the values of the given params, which are escaped as
+// needed. The value of a catch-all parameter may begin with a '/', like the
+// value the router passes to the handle.
+//
+// It fails if there is no route with this name, or if a value is missing, is
+// empty, contains a '/', is a dot segment (. or ..) or doesn't satisfy the
+// constraint of a named parameter, since the path wouldn't match the route
+// then. Neither may the value of a catch-all parameter contain dot segments,
+// which clients and proxies remove from the path.
+func (r *Router) URL(name string, params ...Param) (string, error) {
+	r.mu.RLock()
+	rt := r.names[name]
+	r.mu.RUnlock()
+	if rt == nil {
+		return "", errors.New("no route named '" + name + "'")
+	}
+	path := rt.path
+
+	buf := make([]byte, 0, len(path)+16)
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c != ':' && c != '*' {
+			buf = append(buf, c)
+			continue
+		}
+
+		nameEnd, end := len(path), len(path)
+		if c == ':' {
+			nameEnd, end = wildcardEnd(path, i)
+		}
+		key := path[i+1 : nameEnd]
+		value, ok := paramValue(params, key)
+		if !ok {
+			return "", errors.New("missing value of parameter '" + key + "' for route '" + name + "'")
+		}
+
+		if c == '*' {
+			// the '/' before the catch-all is already in buf
+			value = strings.TrimPrefix(value, "/")
+			for j, seg := range strings.Split(value, "/") {
+				if isDotSegment(seg) {
+					return "", errors.New("value '" + value + "' of parameter '" + key +
+						"' contains the dot segment '" + seg + "' for route '" + name + "'")
+				}
+				if j > 0 {
+					buf = append(buf, '/')
+				}
+				buf = append(buf, url.PathEscape(seg)...)
+			}
+			break
+		}
+
+		if len(value) == 0 {
+			return "", errors.New("empty value of parameter '" + key + "' for route '" + name + "'")
+		}
+		if strings.IndexByte(value, '/') >= 0 {
+			return "", errors.New("value '" + value + "' of parameter '" + key +
+				"' contains a '/' for route '" + name + "'")
+		}
+		// only a value making up a whole segment is one
+		if isDotSegment(value) && len(buf) > 0 && buf[len(buf)-1] == '/' &&
+			(end == len(path) || path[end] == '/') {
+			return "", errors.New("value '" + value + "' of parameter '" + key +
+				"' is a dot segment for route '" + name + "'")
+		}
+		if end != nameEnd {
+			if pc := getConstraint(path[nameEnd+1:end-1], path); !pc.match(value) {
+				return "", errors.New("value '" + value + "' of parameter '" + key +
+					"' doesn't satisfy the constraint '" + pc.expr + "' for route '" + name + "'")
+			}
+		}
+		buf = append(buf, url.PathEscape(value)...)
+		i = end - 1
+	}
+	return string(buf), nil
+}
+
+// isDotSegment reports whether seg is a path segment which is removed when the
+// path is normalized.
+func isDotSegment(seg string) bool {
+	return seg == "." || seg == ".."
+}
+
+func paramValue(ps []Param, key string) (string, bool) {
+	for i := range ps {
+		if ps[i].Key == key {
+			return ps[i].Value, true
+		}
+	}
+	return "", false
+}
+
+// Routes returns all registered routes, in the order of Walk.
+func (r *Router) Routes() []RouteInfo {
+	var routes []RouteInfo
+	r.Walk(func(route RouteInfo) error {
+		routes = append(routes, route)
+		return nil
+	})
+	return routes
+}
+
+// Walk calls fn for every registered route, method by method in alphabetical
+// order, and the routes of a method in the order of its tree. The routes of the
+// sub-routers of hosts follow the ones of r, in the order the hosts are
+// matched. It stops at the first error returned by fn and returns it.
+func (r *Router) Walk(fn func(RouteInfo) error) error {
+	if err := r.walk("", fn); err != nil {
+		return err
+	}
+	for _, h := range r.hosts {
+		if err := h.router.walk(h.pattern, fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// walk calls fn for the routes of r, without the ones of its hosts, which
+// are reported with the given host pattern.
+func (r *Router) walk(host string, fn func(RouteInfo) error) error {
+	r.mu.RLock()
+	rs := r.getRoutes()
+	var names map[string]string
+	if len(r.names) > 0 {
+		names = make(map[string]string, len(r.names))
+		for name, rt := range r.names {
+			names[rt.method+" "+rt.path] = name
+		}
+	}
+	r.mu.RUnlock()
+
+	if rs.methods == nil {
+		return nil
+	}
+	// the methods are sorted already
+	for _, method := range rs.methods.methods {
+		err := rs.walk(method, func(path string, handle Handle) error {
+			return fn(RouteInfo{
+				Host:   host,
+				Method: method,
+				Path:   path,
+				Name:   names[method+" "+path],
+				Handle: handle,
+			})
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+package mrouter
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestRouteName(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	rt := router.Get("/user/:name", handle).Name("user.show")
+	if rt.Method() != "GET" || rt.Path() != "/user/:name" {
+		t.Errorf("wrong route: %s %s", rt.Method(), rt.Path())
+	}
+
+	if recv := catchPanic(func() { router.Post("/user", handle).Name("user.show") }); recv == nil {
+		t.Error("using a route name twice did not panic")
+	}
+	if recv := catchPanic(func() { router.Put("/user/:name", handle).Name("") }); recv == nil {
+		t.Error("empty route name did not panic")
+	}
+
+	// renaming frees the former name
+	rt.Name("user.get")
+	if _, err := router.URL("user.show", Param{"name", "gopher"}); err == nil {
+		t.Error("former route name still in use")
+	}
+	router.Delete("/user/:name", handle).Name("user.show")
+
+	g := router.Group("/api")
+	g.Get("/items/:id", handle).Name("api.item")
+	if url, err := router.URL("api.item", Param{"id", "5"}); err != nil || url != "/api/items/5" {
+		t.Errorf("wrong URL for group route: %s, %v", url, err)
+	}
+
+	// a removed route can't be named, nor given a CORS policy, in either
+	// layout
+	for _, unified := range [...]bool{false, true} {
+		router := New()
+		router.UnifiedTree = unified
+		rt := router.Get("/post/:id", handle)
+		router.Get("/post/:id/comments", handle)
+		router.Remove("GET", "/post/:id")
+		if recv := catchPanic(func() { rt.Name("post") }); recv == nil {
+			t.Errorf("naming a removed route did not panic (unified %v)", unified)
+		}
+		if _, err := router.URL("post", Param{"id", "1"}); err == nil {
+			t.Errorf("removed route got a name (unified %v)", unified)
+		}
+		if recv := catchPanic(func() { rt.CORS(&CORS{AllowedOrigins: []string{"*"}}) }); recv == nil {
+			t.Errorf("setting the CORS policy of a removed route did not panic (unified %v)", unified)
+		}
+
+		// unless it is registered again
+		router.Get("/post/:id", handle)
+		if recv := catchPanic(func() { rt.Name("post") }); recv != nil {
+			t.Errorf("naming a route registered again panicked (unified %v): %v", unified, recv)
+		}
+	}
+}
+
+func TestRouterURL(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.Get("/", handle).Name("index")
+	router.Get("/user/:name", handle).Name("user")
+	router.Get("/user/:id<int>/posts/:post", handle).Name("posts")
+	router.Get("/src/*filepath", handle).Name("src")
+	router.Get("/v:major/info", handle).Name("info")
+
+	tests := []struct {
+		name   string
+		params Params
+		url    string
+		fails  bool
+	}{
+		{"index", nil, "/", false},
+		{"user", Params{{"name", "gopher"}}, "/user/gopher", false},
+		{"user", Params{{"name", "go pher?"}}, "/user/go%20pher%3F", false},
+		{"user", Params{{"other", "x"}, {"name", "gopher"}}, "/user/gopher", false},
+		{"user", nil, "", true},
+		{"user", Params{{"name", ""}}, "", true},
+		{"user", Params{{"name", "a/b"}}, "", true},
+		{"user", Params{{"name", "."}}, "", true},
+		{"user", Params{{"name", ".."}}, "", true},
+		{"user", Params{{"name", "..."}}, "/user/...", false},
+		{"posts", Params{{"id", "42"}, {"post", "hello"}}, "/user/42/posts/hello", false},
+		{"posts", Params{{"id", "gopher"}, {"post", "hello"}}, "", true},
+		{"posts", Params{{"id", "42"}}, "", true},
+		{"src", Params{{"filepath", "/a b/c.go"}}, "/src/a%20b/c.go", false},
+		{"src", Params{{"filepath", "a/c.go"}}, "/src/a/c.go", false},
+		{"src", Params{{"filepath", ""}}, "/src/", false},
+		{"src", Params{{"filepath", "a%20b/../c"}}, "", true},
+		{"src", Params{{"filepath", "/./c"}}, "", true},
+		{"src", Params{{"filepath", ".."}}, "", true},
+		{"src", Params{{"filepath", "a/.b/c."}}, "/src/a/.b/c.", false},
+		{"info", Params{{"major", "."}}, "/v./info", false},
+		{"src", nil, "", true},
+		{"info", Params{{"major", "2"}}, "/v2/info", false},
+		{"nope", nil, "", true},
+	}
+	for _, test := range tests {
+		url, err := router.URL(test.name, test.params...)
+		if test.fails {
+			if err == nil {
+				t.Errorf("URL for %s %v did not fail, got %s", test.name, test.params, url)
+			}
+			continue
+		}
+		if err != nil || url != test.url {
+			t.Errorf("wrong URL for %s %v: want %s, got %s (%v)", test.name, test.params, test.url, url, err)
+		}
+	}
+
+	// the URLs route back to the named route
+	url, _ := router.URL("posts", Param{"id", "42"}, Param{"post", "hello world"})
+	r, _ := http.NewRequest("GET", url, nil)
+	if _, ps, pattern, _ := router.LookupPattern("GET", r.URL.Path); pattern != "/user/:id<int>/posts/:post" ||
+		ps.ByName("post") != "hello world" {
+		t.Errorf("URL %s did not route back to its route: %s %v", url, pattern, ps)
+	}
+}
+
+func TestRouterRoutes(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	if routes := router.Routes(); len(routes) != 0 {
+		t.Errorf("routes of an empty router: %v", routes)
+	}
+
+	router.Post("/user", handle)
+	router.Get("/user/:name", handle).Name("user.show")
+	router.Get("/", handle)
+	router.Get("/src/*filepath", handle)
+	router.Group("/api").Get("/items/:id<int>", handle).Name("api.item")
+
+	var got []string
+	for _, route := range router.Routes() {
+		if route.Handle == nil {
+			t.Errorf("route without handle: %s %s", route.Method, route.Path)
+		}
+		got = append(got, route.Method+" "+route.Path+" "+route.Name)
+	}
+	sort.Strings(got)
+	want := []string{
+		"GET / ",
+		"GET /api/items/:id<int> api.item",
+		"GET /src/*filepath ",
+		"GET /user/:name user.show",
+		"POST /user ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong routes:\n want %q\n got  %q", want, got)
+	}
+
+	// methods are walked in alphabetical order
+	if routes := router.Routes(); routes[len(routes)-1].Method != "POST" {
+		t.Errorf("wrong order of methods: %v", routes)
+	}
+
+	// Walk stops at the first error
+	errStop := errors.New("stop")
+	var n int
+	err := router.Walk(func(route RouteInfo) error {
+		n++
+		return errStop
+	})
+	if err != errStop || n != 1 {
+		t.Errorf("walk did not stop at the first error: %v after %d routes", err, n)
+	}
+
+	// the routes of hosts follow, with their pattern
+	router.Host(":tenant.example.com").Get("/user/:name", handle).Name("tenant.user")
+	router.Host("api.example.com").Get("/", handle)
+	got = got[:0]
+	for _, route := range router.Routes() {
+		got = append(got, route.Host+" "+route.Method+" "+route.Path+" "+route.Name)
+	}
+	want = []string{
+		"api.example.com GET / ",
+		":tenant.example.com GET /user/:name tenant.user",
+	}
+	if len(got) != 7 || !reflect.DeepEqual(got[5:], want) {
+		t.Errorf("wrong routes of hosts:\n want %q\n got  %q", want, got)
+	}
+}
@@ -48,6 +48,10 @@
 //  :name     named parameter
 //  *name     catch-all parameter
 //
+// A named parameter can be followed by a constraint, like :id<int> or
+// :slug<[a-z0-9-]+>. See RegisterConstraint for the predefined types. Values
+// not satisfying the constraint don't match the route.
+//
 // Named parameters are dynamic path segments. They match anything until the
 // next '/' or the path end:
 //  Path: /blog/:category/:post
@@ -82,10 +86,11 @@
 package mrouter
 
 import (
+	"context"
+	"errors"
 	"net/http"
-	"net/url"
-
-	"github.com/prasannavl/goerror/httperror"
+	"sync"
+	"sync/atomic"
 
 	"github.com/prasannavl/mchain"
 )
@@ -106,6 +111,10 @@ type Param struct {
 // It is therefore safe to read values by the index.
 type Params []Param
 
+// MatchedRoutePathParam is the Param name under which the path of the matched
+// route is stored, if Router.SaveMatchedRoutePath is set.
+const MatchedRoutePathParam = "$matchedRoutePath"
+
 // ByName returns the value of the first Param which key matches the given name.
 // If no matching Param is found, an empty string is returned.
 func (ps Params) ByName(name string) string {
@@ -117,16 +126,94 @@ func (ps Params) ByName(name string) string {
 	return ""
 }
 
+// Clone returns a copy of ps, which can be retained by a handle beyond its
+// return if Router.PoolParams is enabled.
+func (ps Params) Clone() Params {
+	if ps == nil {
+		return nil
+	}
+	return append(make(Params, 0, len(ps)), ps...)
+}
+
+// MatchedRoutePath retrieves the path of the matched route, as it was
+// registered (e.g. /user/:name). Router.SaveMatchedRoutePath must have been
+// enabled when the respective handle was called, otherwise this function
+// always returns an empty string.
+func (ps Params) MatchedRoutePath() string {
+	return ps.ByName(MatchedRoutePathParam)
+}
+
+type contextKey struct {
+	name string
+}
+
+// routeContextKey is the request context key under which the result of the
+// route lookup is stored while the middleware stack is running.
+var routeContextKey = &contextKey{"route"}
+
+// routeContext is the result of resolving a request against the routes.
+type routeContext struct {
+	// routes is the snapshot of the routes the request is resolved against
+	routes  *routes
+	handle  Handle
+	params  Params
+	pattern string
+	tsr     bool
+	// method is the method of the route of handle, which differs from the
+	// one of the request for the GET route of HandleHead and for Any
+	method string
+	// head is set if handle is the GET route serving a HEAD request
+	head bool
+	// methods are the methods of the path, if the lookup collected them
+	methods methodMatch
+}
+
+// ParamsFromContext returns the parameter values of the route matched for the
+// request the context belongs to. It is available to the middleware registered
+// with Router.Use, and to the handles if Router.AttachParams is enabled. It
+// returns nil if no route with parameters was matched.
+func ParamsFromContext(ctx context.Context) Params {
+	if rc, ok := ctx.Value(routeContextKey).(*routeContext); ok {
+		return rc.params
+	}
+	return nil
+}
+
+// attachParams returns the request with the route context rc and its
+// parameters attached, see Router.AttachParams. The context is only added if
+// the request doesn't carry rc yet, as it does with middleware.
+func attachParams(req *http.Request, rc *routeContext) *http.Request {
+	if v, _ := req.Context().Value(routeContextKey).(*routeContext); v != rc {
+		// copied, so that rc only moves to the heap if enabled
+		arc := *rc
+		req = req.WithContext(context.WithValue(req.Context(), routeContextKey, &arc))
+	}
+	setPathValues(req, rc.params)
+	return req
+}
+
+// PatternFromContext returns the path of the route matched for the request the
+// context belongs to, as it was registered (e.g. /user/:name). It is available
+// to the middleware registered with Router.Use, and returns an empty string if
+// no route was matched.
+func PatternFromContext(ctx context.Context) string {
+	if rc, ok := ctx.Value(routeContextKey).(*routeContext); ok {
+		return rc.pattern
+	}
+	return ""
+}
+
 // Router is a http.Handler which can be used to dispatch requests to different
 // handler functions via configurable routes
 type Router struct {
-	trees map[string]*node
+	// routes holds the *routes
+	routes atomic.Value
 
 	// Enables automatic redirection if the current route can't be matched but a
 	// handler for the path with (without) the trailing slash exists.
 	// For example if /foo/ is requested but a route only exists for /foo, the
-	// client is redirected to /foo with http status code 301 for GET requests
-	// and 307 for all other request methods.
+	// client is redirected to /foo with the status code configured by
+	// TrailingSlashRedirectCodes.
 	RedirectTrailingSlash bool
 
 	// If enabled, the router tries to fix the current request path, if no
@@ -134,12 +221,20 @@ type Router struct {
 	// First superfluous path elements like ../ or // are removed.
 	// Afterwards the router does a case-insensitive lookup of the cleaned path.
 	// If a handle can be found for this route, the router makes a redirection
-	// to the corrected path with status code 301 for GET requests and 307 for
-	// all other request methods.
+	// to the corrected path with the status code configured by
+	// FixedPathRedirectCodes.
 	// For example /FOO and /..//Foo could be redirected to /foo.
 	// RedirectTrailingSlash is independent of this option.
 	RedirectFixedPath bool
 
+	// The status codes of the redirects made for RedirectTrailingSlash and
+	// RedirectFixedPath, for GET and HEAD requests and for all other request
+	// methods. Codes left zero default to 308 Permanent Redirect. Set them to
+	// MovedRedirectCodes to redirect with 301 for GET requests and 307 for
+	// all other request methods instead.
+	TrailingSlashRedirectCodes RedirectCodes
+	FixedPathRedirectCodes     RedirectCodes
+
 	// If enabled, the router checks if another method is allowed for the
 	// current route, if the current request can not be routed.
 	// If this is the case, the request is answered with 'Method Not Allowed'
@@ -152,16 +247,87 @@ type Router struct {
 	// Custom OPTIONS handlers take priority over automatic replies.
 	HandleOptionsRequest bool
 
-	// Auto redirect when necessary, or else it returns an error which has
-	// the Kind ErrRedirect
+	// If enabled, HEAD requests for a path without a HEAD route are served
+	// by its GET route. The body written by the handle is discarded, while
+	// the header is sent as for a GET request, including the Content-Length.
+	// HEAD is then allowed wherever GET is, for HandleMethodNotAllowed and
+	// HandleOptionsRequest.
+	HandleHead bool
+
+	// If enabled, the replies of HandleMethodNotAllowed and
+	// HandleOptionsRequest aren't written by the router, but returned as a
+	// *MethodNotAllowedError and an *OptionsError, which carry the allowed
+	// methods, so that the chain above can render them like other errors.
+	ReturnMethodErrors bool
+
+	// Auto redirect when necessary, or else it returns a *RedirectError,
+	// which has the status code and Location header of the redirect, and its
+	// kind.
 	HandleRedirect bool
 
+	// If enabled, the Params of the matched route are attached to the
+	// request passed to the handle, so that handles mounted with Handler and
+	// HandlerFunc can read them as well: to its context, for
+	// ParamsFromContext, and with Go 1.22 and later as its path values, for
+	// http.Request.PathValue. This costs an allocation per request.
+	AttachParams bool
+
+	// If enabled, the Params of a request are taken from a pool, and put
+	// back once the handle returned, so that matching a route with
+	// parameters doesn't allocate. The handle and the middleware must then
+	// not retain the Params, e.g. by starting a goroutine, but Clone them.
+	PoolParams bool
+
+	// CORS is the policy for cross-origin requests, if any. Preflight
+	// requests are answered according to it, with the methods allowed for
+	// the path, unless an OPTIONS handle is registered for the path. It can
+	// be overridden per route with Route.CORS.
+	CORS *CORS
+
 	// Configurable mchain.Handler which is called when no matching route is
-	// found. If it is not set, error is return with NotFound.
+	// found. If it is not set, a *NotFoundError is returned.
 	NotFound mchain.Handler
 
 	// Recovers panic into the return error automatically
 	RecoverPanic bool
+
+	// If enabled, adds the path of the matched route, as it was registered,
+	// to the Params passed to the handle. It can be retrieved with
+	// Params.MatchedRoutePath. This costs an allocation for routes without
+	// parameters.
+	SaveMatchedRoutePath bool
+
+	// If enabled, the trees are never modified in place. Instead, routes are
+	// added to and removed from a copy of the tree of the method, which is
+	// then swapped in atomically. Requests being served keep using the trees
+	// they started with, without any locking, so routes can be added, named
+	// and removed concurrently while serving requests. This makes
+	// registration slower, proportional to the number of routes.
+	CopyOnWrite bool
+
+	// If enabled, the routes of all methods are kept in a single tree,
+	// whose leaves hold the handles of their path by method, instead of in a
+	// tree per method. This saves the memory of the paths shared by the
+	// routes of several methods, and the methods allowed for a path are
+	// collected by the lookup of the request, without another walk for the
+	// 405 and OPTIONS replies. It trades speed for memory though: lookups
+	// are slower, since the method of the request has to be found at the
+	// leaves, and so are 405 replies if RedirectFixedPath is enabled, whose
+	// search then walks the paths of all methods. It must be set before
+	// adding routes.
+	UnifiedTree bool
+
+	// mu serializes the changes to the routes, and guards names
+	mu    sync.RWMutex
+	names map[string]*Route
+
+	hosts []*hostRouter
+
+	// paramsPool holds the *Params of PoolParams
+	paramsPool sync.Pool
+
+	middleware []func(mchain.Handler) mchain.Handler
+	chain      mchain.Handler
 }
 
 // New returns a new initialized Router.
@@ -177,39 +343,65 @@ func New() *Router {
 	}
 }
 
+// NewConcurrent returns a new initialized Router like New, with CopyOnWrite
+// enabled, so that routes can be registered while serving requests.
+func NewConcurrent() *Router {
+	r := New()
+	r.CopyOnWrite = true
+	return r
+}
+
 // Get is a shortcut for router.Handle("GET", path, handle)
-func (r *Router) Get(path string, handle Handle) {
-	r.Handle("GET", path, handle)
+func (r *Router) Get(path string, handle Handle) *Route {
+	return r.Handle("GET", path, handle)
 }
 
 // Head is a shortcut for router.Handle("HEAD", path, handle)
-func (r *Router) Head(path string, handle Handle) {
-	r.Handle("HEAD", path, handle)
+func (r *Router) Head(path string, handle Handle) *Route {
+	return r.Handle("HEAD", path, handle)
 }
 
 // Options is a shortcut for router.Handle("OPTIONS", path, handle)
-func (r *Router) Options(path string, handle Handle) {
-	r.Handle("OPTIONS", path, handle)
+func (r *Router) Options(path string, handle Handle) *Route {
+	return r.Handle("OPTIONS", path, handle)
 }
 
 // Post is a shortcut for router.Handle("POST", path, handle)
-func (r *Router) Post(path string, handle Handle) {
-	r.Handle("POST", path, handle)
+func (r *Router) Post(path string, handle Handle) *Route {
+	return r.Handle("POST", path, handle)
 }
 
 // Put is a shortcut for router.Handle("PUT", path, handle)
-func (r *Router) Put(path string, handle Handle) {
-	r.Handle("PUT", path, handle)
+func (r *Router) Put(path string, handle Handle) *Route {
+	return r.Handle("PUT", path, handle)
 }
 
 // Patch is a shortcut for router.Handle("PATCH", path, handle)
-func (r *Router) Patch(path string, handle Handle) {
-	r.Handle("PATCH", path, handle)
+func (r *Router) Patch(path string, handle Handle) *Route {
+	return r.Handle("PATCH", path, handle)
 }
 
 // Delete is a shortcut for router.Handle("DELETE", path, handle)
-func (r *Router) Delete(path string, handle Handle) {
-	r.Handle("DELETE", path, handle)
+func (r *Router) Delete(path string, handle Handle) *Route {
+	return r.Handle("DELETE", path, handle)
+}
+
+// Use appends mchain middleware to the stack that wraps the dispatch of every
+// request, including the automatic redirect, OPTIONS, 405 and NotFound
+// replies. The first middleware is the outermost one.
+//
+// The route is looked up before the stack is run, so the middleware can read
+// its parameters with ParamsFromContext. The stack is composed here, once,
+// and not on every request. Unlike routes, middleware can't be added while
+// serving requests.
+func (r *Router) Use(mw ...func(mchain.Handler) mchain.Handler) {
+	r.middleware = append(r.middleware, mw...)
+
+	var h mchain.Handler = mchain.HandlerFunc(r.dispatch)
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		h = r.middleware[i](h)
+	}
+	r.chain = h
 }
 
 // Handle registers a new request handle with the given path and method.
@@ -219,29 +411,428 @@ func (r *Router) Delete(path string, handle Handle) {
 //
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
-// communication with a proxy).
-func (r *Router) Handle(method, path string, handle Handle) {
-	if path[0] != '/' {
-		panic("path must begin with '/' in path '" + path + "'")
+// communication with a proxy). The method MethodAny registers a route for all
+// methods, like Any.
+//
+// It returns the registered route, which can be given a name to build URLs
+// for it with URL. It panics if the route can't be registered, see
+// TryHandle.
+// Routes can only be added while serving requests if CopyOnWrite is enabled.
+func (r *Router) Handle(method, path string, handle Handle) *Route {
+	rt, err := r.tryHandle(method, path, handle)
+	if err != nil {
+		panic(err.Error())
+	}
+	return rt
+}
+
+// TryHandle is like Handle, but returns an error instead of panicking if the
+// route can't be registered, e.g. for routes loaded from a configuration:
+// an *InvalidPatternError if the path is invalid, a *ConflictError if it
+// conflicts with the path of another route of the method, or a
+// *DuplicateRouteError if there already is a route for the method and path.
+// The routes are left unchanged then.
+func (r *Router) TryHandle(method, path string, handle Handle) error {
+	_, err := r.tryHandle(method, path, handle)
+	return err
+}
+
+func (r *Router) tryHandle(method, path string, handle Handle) (*Route, error) {
+	if len(path) == 0 || path[0] != '/' {
+		return nil, newInvalidPatternError(path, 0, "path must begin with '/'")
+	}
+	if handle == nil {
+		return nil, errors.New("handle must not be nil for path '" + path + "'")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.getRoutes().checkRoute(method, path); err != nil {
+		return nil, err
+	}
+	r.updateRoutes(method, path, handle)
+	return &Route{router: r, method: method, path: path}, nil
+}
+
+// Remove removes the route registered with the given method and path, as it
+// was registered (e.g. /user/:name), and reports whether there was one.
+// Routes can only be removed while serving requests if CopyOnWrite is
+// enabled.
+func (r *Router) Remove(method, path string) bool {
+	if len(path) == 0 || path[0] != '/' {
+		return false
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.updateRoutes(method, path, nil) {
+		return false
+	}
+	for name, rt := range r.names {
+		if rt.method == method && rt.path == path {
+			delete(r.names, name)
+			rt.name = ""
+		}
+	}
+	return true
+}
+
+// routes are the routes of a router. Unless CopyOnWrite is enabled, they are
+// modified in place.
+type routes struct {
+	// unified is set if the routes are kept in paths only, see
+	// Router.UnifiedTree
+	unified bool
+
+	// trees are the trees of the methods, unless unified is set
+	trees map[string]*node
+
+	// paths is the tree of the paths of all methods, whose leaves hold the
+	// routes registered for them by method, see pathKey
+	paths *node
+
+	// counts are the numbers of routes of the methods
+	counts map[string]int
+
+	// methods are all methods with routes, for OPTIONS *, without the
+	// routes themselves
+	methods *methodTable
+
+	// cors are the CORS policies of routes, see Route.CORS
+	cors map[corsKey]*CORS
+}
+
+// noRoutes are the routes of a router without any.
+var noRoutes = &routes{}
+
+// getRoutes returns the current routes.
+func (r *Router) getRoutes() *routes {
+	if rs, _ := r.routes.Load().(*routes); rs != nil {
+		return rs
+	}
+	return noRoutes
+}
+
+// getTrees returns the current trees of all methods.
+func (r *Router) getTrees() map[string]*node {
+	return r.getRoutes().trees
+}
+
+// copyFor returns a copy of rs to change the routes of the method in, which
+// shares everything else with rs.
+func (rs *routes) copyFor(method string) *routes {
+	c := &routes{
+		unified: rs.unified,
+		paths:   rs.paths.clone(),
+		counts:  make(map[string]int, len(rs.counts)+1),
+		methods: rs.methods,
+	}
+	if len(rs.cors) > 0 {
+		c.cors = copyCORS(rs.cors)
+	}
+	for m, n := range rs.counts {
+		c.counts[m] = n
+	}
+	if !rs.unified {
+		c.trees = make(map[string]*node, len(rs.trees)+1)
+		for m, t := range rs.trees {
+			c.trees[m] = t
+		}
+		if t := c.trees[method]; t != nil {
+			c.trees[method] = t.clone()
+		}
+	}
+	return c
+}
+
+// checkRoute returns the error adding the route of the method with the path
+// would fail with, like Router.TryHandle, without modifying the routes.
+func (rs *routes) checkRoute(method, path string) error {
+	if !rs.unified {
+		root := rs.trees[method]
+		if root == nil {
+			return checkPath(path)
+		}
+		err := root.checkRoute(path)
+		switch e := err.(type) {
+		case *ConflictError:
+			e.Method = method
+		case *DuplicateRouteError:
+			e.Method = method
+		}
+		return err
+	}
+
+	if err := checkPath(path); err != nil {
+		return err
+	}
+	if rs.paths == nil {
+		return nil
+	}
+	if err := rs.checkWildcards(method, path); err != nil {
+		return err
+	}
+	// the parameters are renamed in the tree of the paths, so routes whose
+	// parameters are named differently conflict here
+	if leaf := rs.paths.findRoute(pathKey(path)); leaf != nil {
+		if rt := leaf.methods.route(method); rt != nil {
+			if rt.path == path {
+				return &DuplicateRouteError{Method: method, Path: path}
+			}
+			return &ConflictError{Method: method, Path: path, Existing: rt.path}
+		}
+	}
+	return nil
+}
+
+// checkWildcards returns a *ConflictError if a wildcard of the path is named
+// differently than the one of a route of the method in the same place, like
+// the tree of the method would. The routes of other methods don't matter,
+// although the wildcards are shared in the tree of the paths.
+func (rs *routes) checkWildcards(method, path string) error {
+	pos := 0
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c != ':' && c != '*' {
+			continue
+		}
+		nameEnd, end := len(path), len(path)
+		if c == ':' {
+			nameEnd, end = wildcardEnd(path, i)
+		}
+		name := path[i+1 : nameEnd]
+
+		if n := rs.paths.findNode(pathKey(path[:end])); n != nil {
+			err := n.walk(func(leaf *node) error {
+				rt := leaf.methods.route(method)
+				if rt == nil || rt.keys[pos] == name {
+					return nil
+				}
+				return &ConflictError{
+					Method:   method,
+					Path:     path,
+					Existing: rt.path,
+					Segment:  path[i:end],
+					Wildcard: path[i:i+1] + rt.keys[pos] + path[nameEnd:end],
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+		pos++
+		i = end - 1
+	}
+	return nil
+}
+
+// has reports whether the route with the given method and path, as it was
+// registered, exists.
+func (rs *routes) has(method, path string) bool {
+	if !rs.unified {
+		root := rs.trees[method]
+		if root == nil {
+			return false
+		}
+		leaf := root.findRoute(path)
+		return leaf != nil && leaf.fullPath == path
+	}
+
+	if rs.paths == nil {
+		return false
+	}
+	if leaf := rs.paths.findRoute(pathKey(path)); leaf != nil {
+		rt := leaf.methods.route(method)
+		return rt != nil && rt.path == path
+	}
+	return false
+}
+
+// updateRoutes adds the route with the given method, path and handle, or
+// removes it if handle is nil, and reports whether there was one to remove.
+// The caller must hold r.mu, and must have checked a route to be added with
+// routes.checkRoute.
+// If CopyOnWrite is enabled, the changes are made to a copy of the trees
+// involved, which are swapped in along with a new set of routes.
+func (r *Router) updateRoutes(method, path string, handle Handle) bool {
+	rs, _ := r.routes.Load().(*routes)
+	if handle == nil && (rs == nil || rs.counts[method] == 0) {
+		return false
 	}
+	if rs == nil {
+		rs = &routes{
+			unified: r.UnifiedTree,
+			paths:   new(node),
+			counts:  make(map[string]int),
+		}
+		if !rs.unified {
+			rs.trees = make(map[string]*node)
+		}
+		if !r.CopyOnWrite {
+			r.routes.Store(rs)
+		}
+	} else if r.CopyOnWrite {
+		rs = rs.copyFor(method)
+	}
+
+	key := pathKey(path)
+	leaf := rs.paths.findRoute(key)
+	if handle != nil {
+		if !rs.unified {
+			root := rs.trees[method]
+			if root == nil {
+				root = new(node)
+				rs.trees[method] = root
+			}
+			root.addRoute(path, handle)
+		}
+
+		if leaf == nil {
+			rs.paths.addRoute(key, pathLeaf)
+			leaf = rs.paths.findRoute(key)
+		}
+		leaf.methods = leaf.methods.with(method, methodRoute{
+			handle: handle,
+			path:   path,
+			keys:   paramKeys(path),
+		})
+		if rs.counts[method]++; rs.counts[method] == 1 {
+			rs.methods = rs.methods.with(method, methodRoute{})
+		}
+	} else {
+		if leaf == nil {
+			return false
+		}
+		if rt := leaf.methods.route(method); rt == nil || rt.path != path {
+			return false
+		}
+		if !rs.unified {
+			root := rs.trees[method]
+			root.removeRoute(path)
+			if len(root.children) == 0 && root.handle == nil {
+				delete(rs.trees, method)
+			}
+		}
 
-	if r.trees == nil {
-		r.trees = make(map[string]*node)
+		if leaf.methods = leaf.methods.without(method); leaf.methods == nil {
+			rs.paths.removeRoute(key)
+		}
+		delete(rs.cors, corsKey{method, path})
+		if rs.counts[method]--; rs.counts[method] == 0 {
+			delete(rs.counts, method)
+			rs.methods = rs.methods.without(method)
+		}
 	}
 
-	root := r.trees[method]
-	if root == nil {
-		root = new(node)
-		r.trees[method] = root
+	if r.CopyOnWrite {
+		r.routes.Store(rs)
 	}
+	return true
+}
 
-	root.addRoute(path, handle)
+// lookup returns the handle and the path of the route of the method matching
+// the path, along with the values of its parameters, like
+// Router.LookupPattern. The values are appended to p, if it isn't nil.
+func (rs *routes) lookup(method, path string, p Params) (handle Handle, ps Params, pattern string, tsr bool) {
+	return rs.lookupMatch(method, path, p, nil)
+}
+
+// lookupMatch is like lookup, but if the routes are unified and no route is
+// found, it also adds the methods of all leaves matching the path to m, if not
+// nil, and sets m.walked. The allowed methods are then known without walking
+// the tree again, see routes.matchAllowed.
+func (rs *routes) lookupMatch(method, path string, p Params, m *methodMatch) (handle Handle, ps Params, pattern string, tsr bool) {
+	if !rs.unified {
+		if root := rs.trees[method]; root != nil {
+			leaf, ps, tsr := root.getLeaf(path, p)
+			if leaf == nil {
+				return nil, ps, "", tsr
+			}
+			return leaf.handle, ps, leaf.fullPath, tsr
+		}
+		return nil, nil, "", false
+	}
+
+	if rs.paths == nil {
+		return nil, nil, "", false
+	}
+	if rs.counts[method] == 0 {
+		// there is no route to find, nor the values of parameters
+		if m != nil {
+			rs.paths.matchMethods(path, m)
+			m.walked = true
+		}
+		return nil, nil, "", false
+	}
+	leaf, ps, tsr := rs.paths.getStaticLeaf(path, p, method, m)
+	if leaf == nil {
+		if m != nil {
+			m.walked = true
+		}
+		return nil, ps, "", tsr
+	}
+	rt := leaf.methods.route(method)
+	for i, key := range rt.keys {
+		ps[i].Key = key
+	}
+	return rt.handle, ps, rt.path, false
+}
+
+// findCaseInsensitivePath makes a case-insensitive lookup of the path for the
+// method, like node.findCaseInsensitivePath.
+func (rs *routes) findCaseInsensitivePath(method, path string, fixTrailingSlash bool) ([]byte, bool) {
+	if rs.counts[method] == 0 {
+		return nil, false
+	}
+	if rs.unified {
+		return rs.paths.findMethodCaseInsensitivePath(path, method, fixTrailingSlash)
+	}
+	return rs.trees[method].findCaseInsensitivePath(path, fixTrailingSlash)
+}
+
+// walk calls fn for every route of the method, in the order of its tree. It
+// stops at the first error returned by fn.
+func (rs *routes) walk(method string, fn func(path string, handle Handle) error) error {
+	if !rs.unified {
+		if root := rs.trees[method]; root != nil {
+			return root.walk(func(n *node) error {
+				return fn(n.fullPath, n.handle)
+			})
+		}
+		return nil
+	}
+	return rs.paths.walk(func(n *node) error {
+		if rt := n.methods.route(method); rt != nil {
+			return fn(rt.path, rt.handle)
+		}
+		return nil
+	})
+}
+
+// paramKeys returns the names of the parameters of the path, in order.
+func paramKeys(path string) []string {
+	var keys []string
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c != ':' && c != '*' {
+			continue
+		}
+		nameEnd, end := len(path), len(path)
+		if c == ':' {
+			nameEnd, end = wildcardEnd(path, i)
+		}
+		keys = append(keys, path[i+1:nameEnd])
+		i = end - 1
+	}
+	return keys
 }
 
 // Handler is an adapter which allows the usage of an mchain.Handler as a
 // request handle.
-func (r *Router) Handler(method, path string, handler mchain.Handler) {
-	r.Handle(method, path,
+func (r *Router) Handler(method, path string, handler mchain.Handler) *Route {
+	return r.Handle(method, path,
 		func(w http.ResponseWriter, req *http.Request, _ Params) error {
 			return handler.ServeHTTP(w, req)
 		},
@@ -250,8 +841,8 @@ func (r *Router) Handler(method, path string, handler mchain.Handler) {
 
 // HandlerFunc is an adapter which allows the usage of an mchain.HandlerFunc as a
 // request handle.
-func (r *Router) HandlerFunc(method, path string, handler mchain.HandlerFunc) {
-	r.Handler(method, path, handler)
+func (r *Router) HandlerFunc(method, path string, handler mchain.HandlerFunc) *Route {
+	return r.Handler(method, path, handler)
 }
 
 // Lookup allows the manual lookup of a method + path combo.
@@ -260,99 +851,177 @@ func (r *Router) HandlerFunc(method, path string, handler mchain.HandlerFunc) {
 // values. Otherwise the third return value indicates whether a redirection to
 // the same path with an extra / without the trailing slash should be performed.
 func (r *Router) Lookup(method, path string) (Handle, Params, bool) {
-	if root := r.trees[method]; root != nil {
-		return root.getValue(path)
-	}
-	return nil, nil, false
+	handle, ps, _, tsr := r.getRoutes().lookup(method, path, nil)
+	return handle, ps, tsr
 }
 
-func (r *Router) allowed(path, reqMethod string) (allow string) {
-	if path == "*" { // server-wide
-		for method := range r.trees {
-			if method == "OPTIONS" {
-				continue
-			}
+// LookupPattern is like Lookup, but additionally returns the path the matched
+// route was registered with, e.g. /user/:name for the path /user/gopher.
+// This is useful to label requests by their route instead of their path.
+func (r *Router) LookupPattern(method, path string) (Handle, Params, string, bool) {
+	return r.getRoutes().lookup(method, path, nil)
+}
 
-			// add request method to list of allowed methods
-			if len(allow) == 0 {
-				allow = method
-			} else {
-				allow += ", " + method
-			}
-		}
-	} else { // specific path
-		for method := range r.trees {
-			// Skip the requested method - we already tried this one
-			if method == reqMethod || method == "OPTIONS" {
-				continue
-			}
+// ServeHTTP makes the router implement the http.Handler interface.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) (err error) {
+	if r.RecoverPanic {
+		defer mchain.RecoverIntoError(&err)
+	}
 
-			handle, _, _ := r.trees[method].getValue(path)
-			if handle != nil {
-				// add request method to list of allowed methods
-				if len(allow) == 0 {
-					allow = method
-				} else {
-					allow += ", " + method
-				}
-			}
+	var host *hostRouter
+	if len(r.hosts) > 0 {
+		host = r.lookupHost(req.Host)
+	}
+
+	var rc routeContext
+	if host != nil {
+		rc.routes = host.router.getRoutes()
+	} else {
+		rc.routes = r.getRoutes()
+	}
+	var pp *Params
+	var ps Params
+	if r.PoolParams {
+		pp = r.getParams(rc.routes, host)
+		ps = *pp
+	}
+
+	rc.method = req.Method
+	rc.handle, rc.params, rc.pattern, rc.tsr = rc.routes.lookupMatch(req.Method, req.URL.Path, ps, &rc.methods)
+	if rc.handle == nil && r.HandleHead && req.Method == "HEAD" {
+		var tsr bool
+		rc.handle, rc.params, rc.pattern, tsr = rc.routes.lookupHead(req.URL.Path, ps)
+		rc.tsr = rc.tsr || tsr
+		if rc.handle != nil {
+			rc.head = true
+			rc.method = "GET"
+		}
+	}
+	if rc.handle == nil {
+		var tsr bool
+		rc.handle, rc.params, rc.pattern, tsr = rc.routes.lookupAny(req.URL.Path, ps)
+		rc.tsr = rc.tsr || tsr
+		if rc.handle != nil {
+			rc.method = MethodAny
+		}
+	}
+	if rc.handle != nil {
+		if host != nil && host.wildcard {
+			rc.params = host.appendParams(req.Host, rc.params)
 		}
+		if r.SaveMatchedRoutePath {
+			rc.params = append(rc.params, Param{MatchedRoutePathParam, rc.pattern})
+		}
+	}
+
+	if r.chain != nil {
+		// copied, so that only the middleware path moves it to the heap
+		mrc := rc
+		ctx := context.WithValue(req.Context(), routeContextKey, &mrc)
+		err = r.chain.ServeHTTP(w, req.WithContext(ctx))
+	} else {
+		err = r.serve(w, req, &rc)
 	}
-	if len(allow) > 0 {
-		allow += ", OPTIONS"
+	if pp != nil {
+		r.putParams(pp, rc.params)
 	}
-	return
+	return err
 }
 
-// ServeHTTP makes the router implement the http.Handler interface.
-func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) (err error) {
-	path := req.URL.Path
+// dispatch is the innermost handler of the middleware stack. It picks up the
+// route resolved by ServeHTTP from the request context.
+func (r *Router) dispatch(w http.ResponseWriter, req *http.Request) error {
+	rc, _ := req.Context().Value(routeContextKey).(*routeContext)
+	if rc == nil {
+		rc = &routeContext{routes: r.getRoutes()}
+	}
+	return r.serve(w, req, rc)
+}
 
-	if r.RecoverPanic {
-		defer mchain.RecoverIntoError(&err)
+func (r *Router) serve(w http.ResponseWriter, req *http.Request, rc *routeContext) error {
+	if r.CORS != nil || len(rc.routes.cors) > 0 {
+		if done, err := r.handleCORS(w, req, rc); done {
+			return err
+		}
 	}
 
-	if root := r.trees[req.Method]; root != nil {
-		if handle, ps, tsr := root.getValue(path); handle != nil {
-			return handle(w, req, ps)
-		} else if req.Method != "CONNECT" && path != "/" {
-			redirectURL := *req.URL
-			if redirectURL.Host == "" {
-				redirectURL.Host = req.Host
-			}
-			if tsr && r.RedirectTrailingSlash {
-				if len(path) > 1 && path[len(path)-1] == '/' {
-					redirectURL.Path = path[:len(path)-1]
-				} else {
-					redirectURL.Path = path + "/"
-				}
-				return handleRedirect(r, w, req, &redirectURL)
+	if rc.handle != nil {
+		if r.AttachParams && len(rc.params) > 0 {
+			req = attachParams(req, rc)
+		}
+		if rc.head {
+			hw := &headWriter{ResponseWriter: w}
+			err := rc.handle(hw, req, rc.params)
+			hw.finish()
+			return err
+		}
+		return rc.handle(w, req, rc.params)
+	}
+
+	path := req.URL.Path
+
+	// HEAD requests are redirected to the paths of the GET routes as well
+	headGET := r.HandleHead && req.Method == "HEAD"
+	if (rc.routes.counts[req.Method] > 0 || (headGET && rc.routes.counts["GET"] > 0) ||
+		rc.routes.counts[MethodAny] > 0) && req.Method != "CONNECT" && path != "/" {
+		redirectURL := *req.URL
+		if redirectURL.Host == "" {
+			redirectURL.Host = req.Host
+		}
+		if rc.tsr && r.RedirectTrailingSlash {
+			if len(path) > 1 && path[len(path)-1] == '/' {
+				redirectURL.Path = path[:len(path)-1]
+			} else {
+				redirectURL.Path = path + "/"
 			}
+			return handleRedirect(r, w, req, &redirectURL, TrailingSlashRedirect)
+		}
 
-			// Try to fix the request path
-			if r.RedirectFixedPath {
-				fixedPath, found := root.findCaseInsensitivePath(
+		// Try to fix the request path
+		if r.RedirectFixedPath {
+			fixedPath, found := rc.routes.findCaseInsensitivePath(
+				req.Method,
+				CleanPath(path),
+				r.RedirectTrailingSlash,
+			)
+			if !found && headGET {
+				fixedPath, found = rc.routes.findCaseInsensitivePath(
+					"GET",
 					CleanPath(path),
 					r.RedirectTrailingSlash,
 				)
-				if found {
-					redirectURL.Path = string(fixedPath)
-					return handleRedirect(r, w, req, &redirectURL)
-				}
+			}
+			if !found {
+				fixedPath, found = rc.routes.findCaseInsensitivePath(
+					MethodAny,
+					CleanPath(path),
+					r.RedirectTrailingSlash,
+				)
+			}
+			if found {
+				redirectURL.Path = string(fixedPath)
+				return handleRedirect(r, w, req, &redirectURL, FixedPathRedirect)
 			}
 		}
 	}
 
 	if r.HandleOptionsRequest && req.Method == "OPTIONS" {
-		if allow := r.allowed(path, req.Method); len(allow) > 0 {
-			w.Header().Set("Allow", allow)
+		if allowed, allow := rc.routes.matchAllowed(path, &rc.methods, r.HandleHead); len(allowed) > 0 {
+			if r.ReturnMethodErrors {
+				return newOptionsError(allowed)
+			}
+			w.Header().Set("Allow", allow[0])
 			return nil
 		}
 		return handleNotFound(r, w, req)
 	}
 	if r.HandleMethodNotAllowed {
-		if allow := r.allowed(path, req.Method); len(allow) > 0 {
-			w.Header().Set("Allow", allow)
+		// the requested method is not allowed, since it didn't match
+		if allowed, allow := rc.routes.matchAllowed(path, &rc.methods, r.HandleHead); len(allowed) > 0 {
+			if r.ReturnMethodErrors {
+				return newMethodNotAllowedError(allowed)
+			}
+			w.Header().Set("Allow", allow[0])
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return nil
 		}
@@ -362,21 +1031,9 @@ func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) (err error)
 	return handleNotFound(r, w, req)
 }
 
-func handleRedirect(r *Router, w http.ResponseWriter, req *http.Request, url *url.URL) error {
-	code := http.StatusPermanentRedirect
-	if r.HandleRedirect {
-		w.Header().Set("Location", url.String())
-		w.WriteHeader(code)
-		return nil
-	}
-	e := httperror.New(code, "route redirection", true)
-	e.Headers().Set("Location", url.String())
-	return e
-}
-
 func handleNotFound(r *Router, w http.ResponseWriter, req *http.Request) error {
 	if r.NotFound != nil {
 		return r.NotFound.ServeHTTP(w, req)
 	}
-	return httperror.New(http.StatusNotFound, "route not found", false)
+	return newNotFoundError(req.URL.Path)
 }
@@ -12,6 +12,7 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/prasannavl/goerror/httperror"
@@ -508,6 +509,170 @@ func TestRouterLookup(t *testing.T) {
 	}
 }
 
+func TestRouterRemove(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.Get("/user/:name", handle).Name("user")
+	router.Get("/user/:name/about", handle)
+	router.Post("/user/:name", handle)
+
+	if router.Remove("GET", "/user/gopher") || router.Remove("PUT", "/user/:name") ||
+		router.Remove("GET", "user/:name") {
+		t.Error("removing an unregistered route succeeded")
+	}
+	if !router.Remove("GET", "/user/:name") {
+		t.Fatal("removing a route failed")
+	}
+	if router.Remove("GET", "/user/:name") {
+		t.Error("removing a route twice succeeded")
+	}
+
+	if handle, _, _ := router.Lookup("GET", "/user/gopher"); handle != nil {
+		t.Error("removed route still found")
+	}
+	if handle, _, _ := router.Lookup("GET", "/user/gopher/about"); handle == nil {
+		t.Error("route next to the removed route not found")
+	}
+	if _, err := router.URL("user", Param{"name", "gopher"}); err == nil {
+		t.Error("name of the removed route still in use")
+	}
+
+	r, _ := http.NewRequest("GET", "/user/gopher", nil)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed || w.Header().Get("Allow") != "POST, OPTIONS" {
+		t.Errorf("NotAllowed handling failed: Code=%d, Header=%v", w.Code, w.Header())
+	}
+
+	// the tree of a method without routes is removed
+	router.Remove("GET", "/user/:name/about")
+	router.Remove("POST", "/user/:name")
+	if routes := router.Routes(); len(routes) != 0 {
+		t.Errorf("routes left after removing all routes: %v", routes)
+	}
+	r, _ = http.NewRequest("OPTIONS", "*", nil)
+	w = httptest.NewRecorder()
+	if e, ok := router.ServeHTTP(w, r).(httperror.HttpError); !ok || e.Code() != http.StatusNotFound {
+		t.Errorf("OPTIONS without routes not handled as NotFound: Code=%d, Header=%v", w.Code, w.Header())
+	}
+}
+
+func TestRouterCopyOnWrite(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.CopyOnWrite = true
+	router.Get("/user/:name", handle)
+
+	// the trees in use are never modified
+	trees := router.getTrees()
+	shape := treeShape(trees["GET"])
+	router.Get("/user/:name/about", handle)
+	router.Remove("GET", "/user/:name")
+	router.Post("/user", handle)
+	if got := treeShape(trees["GET"]); got != shape || len(trees) != 1 {
+		t.Errorf("trees modified in copy-on-write mode:\n got  %s\n want %s", got, shape)
+	}
+	if handle, _, _ := router.Lookup("GET", "/user/gopher/about"); handle == nil {
+		t.Error("route added in copy-on-write mode not found")
+	}
+
+	// a failed registration leaves the trees as they were
+	trees = router.getTrees()
+	if recv := catchPanic(func() { router.Get("/user/:id/about", handle) }); recv == nil {
+		t.Fatal("conflicting route did not panic")
+	}
+	if router.getTrees()["GET"] != trees["GET"] {
+		t.Error("trees replaced by a failed registration")
+	}
+
+	// register and remove routes while serving requests
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			path := fmt.Sprintf("/dyn/%d", i)
+			router.Get(path, handle)
+			if i%2 == 0 {
+				router.Remove("GET", path)
+			}
+		}
+	}()
+	for {
+		select {
+		case <-done:
+			if handle, _, _ := router.Lookup("GET", "/dyn/99"); handle == nil {
+				t.Error("route added while serving not found")
+			}
+			return
+		default:
+			r, _ := http.NewRequest("GET", "/user/gopher/about", nil)
+			if err := router.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+				t.Fatalf("serving while registering failed: %v", err)
+			}
+		}
+	}
+}
+
+func TestRouterConcurrent(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := NewConcurrent()
+	router.Get("/user/:name", handle)
+
+	const writers, routes = 4, 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < routes; j++ {
+				path := fmt.Sprintf("/w%d/:id/%d", i, j)
+				name := fmt.Sprintf("w%d.%d", i, j)
+				router.Get(path, handle).Name(name)
+				if _, err := router.URL(name, Param{"id", "x"}); err != nil {
+					t.Errorf("URL of route added concurrently failed: %v", err)
+				}
+				if j%3 == 0 && !router.Remove("GET", path) {
+					t.Errorf("removing route added concurrently failed: %s", path)
+				}
+			}
+		}(i)
+	}
+
+	stop := make(chan struct{})
+	var readers sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				r, _ := http.NewRequest("GET", "/user/gopher", nil)
+				if err := router.ServeHTTP(httptest.NewRecorder(), r); err != nil {
+					t.Errorf("serving while registering failed: %v", err)
+				}
+				r, _ = http.NewRequest("GET", "/w0/x/1/", nil)
+				router.ServeHTTP(httptest.NewRecorder(), r)
+				router.Routes()
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(stop)
+	readers.Wait()
+
+	if n, want := len(router.Routes()), 1+writers*(routes-(routes+2)/3); n != want {
+		t.Errorf("wrong number of routes: want %d, got %d", want, n)
+	}
+}
+
 type mockFileSystem struct {
 	opened bool
 }
@@ -516,3 +681,348 @@ func (mfs *mockFileSystem) Open(name string) (http.File, error) {
 	mfs.opened = true
 	return nil, errors.New("this is just a mock")
 }
+
+func TestRouterUse(t *testing.T) {
+	var trace []string
+	var seen Params
+	composed := 0
+	mw := func(name string) func(mchain.Handler) mchain.Handler {
+		return func(next mchain.Handler) mchain.Handler {
+			composed++
+			return mchain.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+				trace = append(trace, name)
+				seen = ParamsFromContext(r.Context())
+				return next.ServeHTTP(w, r)
+			})
+		}
+	}
+
+	router := New()
+	router.Use(mw("outer"), mw("inner"))
+	router.Get("/user/:name", func(w http.ResponseWriter, r *http.Request, ps Params) error {
+		trace = append(trace, "handle")
+		return nil
+	})
+	router.Post("/path", func(w http.ResponseWriter, r *http.Request, ps Params) error {
+		return nil
+	})
+	// composition of the full stack happens when Use is called
+	composed = 0
+
+	r, _ := http.NewRequest("GET", "/user/gopher", nil)
+	w := httptest.NewRecorder()
+	if err := router.ServeHTTP(w, r); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if want := []string{"outer", "inner", "handle"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("wrong middleware order: want %v, got %v", want, trace)
+	}
+	if want := (Params{Param{"name", "gopher"}}); !reflect.DeepEqual(seen, want) {
+		t.Errorf("wrong params in middleware: want %v, got %v", want, seen)
+	}
+
+	// NotFound
+	trace = nil
+	r, _ = http.NewRequest("GET", "/nope", nil)
+	w = httptest.NewRecorder()
+	e, ok := router.ServeHTTP(w, r).(httperror.HttpError)
+	if !ok || e.Code() != http.StatusNotFound {
+		t.Errorf("NotFound through middleware failed: %v", e)
+	}
+	if want := []string{"outer", "inner"}; !reflect.DeepEqual(trace, want) {
+		t.Errorf("middleware not run for NotFound: want %v, got %v", want, trace)
+	}
+
+	// 405
+	trace = nil
+	r, _ = http.NewRequest("GET", "/path", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("NotAllowed through middleware failed: Code=%d", w.Code)
+	}
+	if len(trace) != 2 {
+		t.Errorf("middleware not run for NotAllowed: %v", trace)
+	}
+
+	// OPTIONS
+	trace = nil
+	r, _ = http.NewRequest("OPTIONS", "/path", nil)
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	if allow := w.Header().Get("Allow"); allow != "POST, OPTIONS" {
+		t.Errorf("unexpected Allow header value through middleware: %s", allow)
+	}
+	if len(trace) != 2 {
+		t.Errorf("middleware not run for OPTIONS: %v", trace)
+	}
+
+	if composed != 0 {
+		t.Errorf("middleware stack composed per request: %d times", composed)
+	}
+}
+
+func TestRouterMatchedRoutePath(t *testing.T) {
+	var handled string
+	handle := func(_ http.ResponseWriter, _ *http.Request, ps Params) error {
+		handled = ps.MatchedRoutePath()
+		return nil
+	}
+
+	var seen string
+	router := New()
+	router.SaveMatchedRoutePath = true
+	router.Use(func(next mchain.Handler) mchain.Handler {
+		return mchain.HandlerFunc(func(w http.ResponseWriter, r *http.Request) error {
+			seen = PatternFromContext(r.Context())
+			return next.ServeHTTP(w, r)
+		})
+	})
+	router.Get("/user/:name", handle)
+	router.Get("/src/*filepath", handle)
+	router.Get("/static", handle)
+
+	tests := []struct {
+		path    string
+		pattern string
+	}{
+		{"/user/gopher", "/user/:name"},
+		{"/src/some/file.go", "/src/*filepath"},
+		{"/static", "/static"},
+		{"/nope", ""},
+	}
+	for _, test := range tests {
+		handled, seen = "", ""
+		r, _ := http.NewRequest("GET", test.path, nil)
+		router.ServeHTTP(httptest.NewRecorder(), r)
+		if handled != test.pattern {
+			t.Errorf("wrong matched route path for %s: want %q, got %q", test.path, test.pattern, handled)
+		}
+		if seen != test.pattern {
+			t.Errorf("wrong pattern in context for %s: want %q, got %q", test.path, test.pattern, seen)
+		}
+
+		_, _, pattern, _ := router.LookupPattern("GET", test.path)
+		if pattern != test.pattern {
+			t.Errorf("wrong pattern from lookup for %s: want %q, got %q", test.path, test.pattern, pattern)
+		}
+	}
+}
+
+// unifiedRoutes are routes of several methods, overlapping in many ways.
+var unifiedRoutes = []struct {
+	method, path string
+}{
+	{"GET", "/"},
+	{"GET", "/user/:name"},
+	{"POST", "/user/new"},
+	{"PUT", "/user/:id<int>"},
+	{"DELETE", "/user/:id"},
+	{"GET", "/user/:name/posts/:post"},
+	{"POST", "/user/:uid/posts"},
+	{"GET", "/src/*filepath"},
+	{"DELETE", "/src/a"},
+	{"GET", "/dir/"},
+	{"POST", "/dir"},
+	{"GET", "/Caps"},
+	{"PATCH", "/caps/"},
+	{"OPTIONS", "/opt"},
+}
+
+func newUnifiedTestRouter(unified bool) *Router {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.UnifiedTree = unified
+	for _, route := range unifiedRoutes {
+		router.Handle(route.method, route.path, handle)
+	}
+	return router
+}
+
+// compareRouters checks that the routers route the paths the same way.
+func compareRouters(t *testing.T, want, got *Router, paths []string) {
+	for _, method := range [...]string{"GET", "POST", "PUT", "DELETE", "PATCH", "OPTIONS", "HEAD"} {
+		for _, path := range paths {
+			wh, wps, wpattern, wtsr := want.LookupPattern(method, path)
+			gh, gps, gpattern, gtsr := got.LookupPattern(method, path)
+			if (wh == nil) != (gh == nil) || wpattern != gpattern || wtsr != gtsr ||
+				(wh != nil && !reflect.DeepEqual(wps, gps)) {
+				t.Errorf("wrong lookup of %s %s: want %q %v %v, got %q %v %v",
+					method, path, wpattern, wps, wtsr, gpattern, gps, gtsr)
+			}
+
+			r, _ := http.NewRequest(method, path, nil)
+			ww, gw := httptest.NewRecorder(), httptest.NewRecorder()
+			werr, gerr := want.ServeHTTP(ww, r), got.ServeHTTP(gw, r)
+			if ww.Code != gw.Code || !reflect.DeepEqual(ww.Header(), gw.Header()) ||
+				fmt.Sprint(werr) != fmt.Sprint(gerr) {
+				t.Errorf("wrong reply to %s %s: want %d %v %v, got %d %v %v",
+					method, path, ww.Code, ww.Header(), werr, gw.Code, gw.Header(), gerr)
+			}
+		}
+	}
+}
+
+func TestRouterUnifiedTree(t *testing.T) {
+	paths := []string{
+		"/", "/user/gopher", "/user/new", "/user/42", "/user/", "/user",
+		"/user/gopher/posts/1", "/user/gopher/posts", "/user/42/posts/",
+		"/src/", "/src", "/src/a", "/src/a/b", "/dir", "/dir/", "/DIR",
+		"/caps", "/CAPS/", "/caps/", "/opt", "/opt/", "/nope", "*",
+	}
+
+	trees, unified := newUnifiedTestRouter(false), newUnifiedTestRouter(true)
+	if unified.getTrees() != nil {
+		t.Error("unified router has trees per method")
+	}
+	compareRouters(t, trees, unified, paths)
+	if want, got := trees.Routes(), unified.Routes(); len(want) != len(got) {
+		t.Errorf("wrong routes: want %d, got %d", len(want), len(got))
+	} else {
+		for i := range want {
+			if want[i].Method != got[i].Method || want[i].Path != got[i].Path {
+				t.Errorf("wrong route: want %s %s, got %s %s",
+					want[i].Method, want[i].Path, got[i].Method, got[i].Path)
+			}
+		}
+	}
+
+	// the parameters are named by the route of the method
+	_, ps, _, _ := unified.LookupPattern("POST", "/user/gopher/posts")
+	if !reflect.DeepEqual(ps, Params{{"uid", "gopher"}}) {
+		t.Errorf("wrong params: %v", ps)
+	}
+
+	// removed routes, the last one of a path and of a method included
+	for _, router := range [...]*Router{trees, unified} {
+		router.Remove("GET", "/user/:name")
+		router.Remove("DELETE", "/src/a")
+		router.Remove("OPTIONS", "/opt")
+		if router.Remove("PUT", "/user/:num<int>") {
+			t.Error("removed a route registered with another path")
+		}
+	}
+	compareRouters(t, trees, unified, paths)
+
+	// a route can't be added twice
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+	if recv := catchPanic(func() { unified.Post("/user/:name/posts", handle) }); recv == nil {
+		t.Error("adding a route twice did not panic")
+	}
+	if recv := catchPanic(func() { unified.Get("/user/:name<", handle) }); recv == nil {
+		t.Error("adding an invalid route did not panic")
+	}
+}
+
+func TestRouterUnifiedTreeCopyOnWrite(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := NewConcurrent()
+	router.UnifiedTree = true
+	router.Get("/user/:name", handle)
+
+	rs := router.getRoutes()
+	router.Post("/user/:id", handle)
+	router.Remove("GET", "/user/:name")
+	if h, _, _, _ := rs.lookup("GET", "/user/gopher", nil); h == nil {
+		t.Error("routes modified in copy-on-write mode")
+	}
+	if h, _, _, _ := rs.lookup("POST", "/user/gopher", nil); h != nil {
+		t.Error("routes modified in copy-on-write mode")
+	}
+	if h, ps, _ := router.Lookup("POST", "/user/gopher"); h == nil || ps.ByName("id") != "gopher" {
+		t.Error("route added in copy-on-write mode not found")
+	}
+	if h, _, _ := router.Lookup("GET", "/user/gopher"); h != nil {
+		t.Error("route removed in copy-on-write mode found")
+	}
+}
+
+// benchmarkLayout serves requests with the routes of a REST API for several
+// methods, kept in a tree per method or in a single tree.
+func benchmarkLayout(b *testing.B, unified bool, method, path string) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	router.UnifiedTree = unified
+	for _, resource := range [...]string{"users", "repos", "issues", "orgs", "teams"} {
+		router.Get("/"+resource, handle)
+		router.Post("/"+resource, handle)
+		router.Get("/"+resource+"/:id", handle)
+		router.Put("/"+resource+"/:id", handle)
+		router.Patch("/"+resource+"/:id", handle)
+		router.Delete("/"+resource+"/:id", handle)
+		router.Get("/"+resource+"/:id/events", handle)
+	}
+
+	r, _ := http.NewRequest(method, path, nil)
+	w := &headerWriter{header: make(http.Header)}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkLayoutTreesStatic(b *testing.B) {
+	benchmarkLayout(b, false, "GET", "/teams")
+}
+
+func BenchmarkLayoutUnifiedStatic(b *testing.B) {
+	benchmarkLayout(b, true, "GET", "/teams")
+}
+
+func BenchmarkLayoutTreesParam(b *testing.B) {
+	benchmarkLayout(b, false, "DELETE", "/teams/42")
+}
+
+func BenchmarkLayoutUnifiedParam(b *testing.B) {
+	benchmarkLayout(b, true, "DELETE", "/teams/42")
+}
+
+func BenchmarkLayoutTreesMethodNotAllowed(b *testing.B) {
+	benchmarkLayout(b, false, "DELETE", "/teams/42/events")
+}
+
+func BenchmarkLayoutUnifiedMethodNotAllowed(b *testing.B) {
+	benchmarkLayout(b, true, "DELETE", "/teams/42/events")
+}
+
+func BenchmarkLayoutTreesOptions(b *testing.B) {
+	benchmarkLayout(b, false, "OPTIONS", "/teams/42")
+}
+
+func BenchmarkLayoutUnifiedOptions(b *testing.B) {
+	benchmarkLayout(b, true, "OPTIONS", "/teams/42")
+}
+
+// benchmarkHTTPRouterServe serves a request with the routes of
+// httprouterBenchRoutes, which compares the router with the one of httprouter
+// it is derived from, see the README.
+func benchmarkHTTPRouterServe(b *testing.B, path string) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ Params) error { return nil }
+
+	router := New()
+	for _, route := range httprouterBenchRoutes {
+		router.Get(route, handle)
+	}
+
+	r, _ := http.NewRequest("GET", path, nil)
+	w := new(mockResponseWriter)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		router.ServeHTTP(w, r)
+	}
+}
+
+func BenchmarkRouterHTTPRouterStatic(b *testing.B) {
+	benchmarkHTTPRouterServe(b, "/doc/go_faq.html")
+}
+
+func BenchmarkRouterHTTPRouterParam(b *testing.B) {
+	benchmarkHTTPRouterServe(b, "/info/gordon/project/go")
+}
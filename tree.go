@@ -26,6 +26,11 @@ func countParams(path string) uint8 {
 			continue
 		}
 		n++
+
+		// skip the constraint, it may contain ':' and '*'
+		if _, end := wildcardEnd(path, i); end > i {
+			i = end - 1
+		}
 	}
 	if n >= 255 {
 		return 255
@@ -33,6 +38,46 @@ func countParams(path string) uint8 {
 	return uint8(n)
 }
 
+// wildcardEnd returns the end of the name and the end of the wildcard
+// beginning at path[i]. The name of a param may be followed by a constraint in
+// angle brackets, which can contain any char, as long as the brackets are
+// balanced. If the constraint is not terminated, end is -1.
+func wildcardEnd(path string, i int) (nameEnd, end int) {
+	end = i + 1
+	for end < len(path) && path[end] != '/' && path[end] != '<' {
+		end++
+	}
+	nameEnd = end
+	if end == len(path) || path[end] != '<' {
+		return
+	}
+
+	depth := 0
+	for end < len(path) {
+		c := path[end]
+		end++
+		switch c {
+		case '<':
+			depth++
+		case '>':
+			depth--
+			if depth == 0 {
+				return
+			}
+		}
+	}
+	return nameEnd, -1
+}
+
+// wildcardConstraint returns the constraint of the wildcard path[:end], or nil
+// if it has none.
+func wildcardConstraint(path string, nameEnd, end int, fullPath string) *paramConstraint {
+	if nameEnd == end {
+		return nil
+	}
+	return getConstraint(path[nameEnd+1:end-1], fullPath)
+}
+
 type nodeType uint8
 
 const (
@@ -42,6 +87,16 @@ const (
 	catchAll
 )
 
+// A node is either static, holding a part of a path, or a wildcard, holding
+// the name of a parameter.
+//
+// The children of a node are ordered: the static children come first, in the
+// order of indices, followed by the wildcard children, if wildChild is set.
+// The param children with a constraint come first, in the order of
+// registration, followed by at most one param child without a constraint and
+// at most one catchAll child. This is also the order of precedence while
+// looking up a path.
+// A catchAll child is always the child of a node whose path ends with '/'.
 type node struct {
 	path      string
 	wildChild bool
@@ -51,6 +106,18 @@ type node struct {
 	children  []*node
 	handle    Handle
 	priority  uint32
+
+	// constraint is the constraint of a param node, if any. The path of the
+	// node holds the name only.
+	constraint *paramConstraint
+
+	// fullPath is the complete path the handle was registered with. It is only
+	// set on nodes holding a handle.
+	fullPath string
+
+	// methods are the methods registered for the path of a node holding a
+	// handle in the tree of the paths of all methods, see routes.
+	methods *methodTable
 }
 
 // increments priority of the given child and reorders if necessary
@@ -77,251 +144,671 @@ func (n *node) incrementChildPrio(pos int) int {
 	return newPos
 }
 
-// addRoute adds a node with the given handle to the path.
-// Not concurrency-safe!
-func (n *node) addRoute(path string, handle Handle) {
-	fullPath := path
-	n.priority++
-	numParams := countParams(path)
+// adds a static child, placed before the wildcard children
+func (n *node) addStaticChild(c byte, child *node) {
+	pos := len(n.indices)
+	// []byte for proper unicode char conversion, see #65
+	n.indices += string([]byte{c})
+	n.children = append(n.children, nil)
+	copy(n.children[pos+1:], n.children[pos:])
+	n.children[pos] = child
+	n.incrementChildPrio(pos)
+}
 
-	// non-empty tree
-	if len(n.path) > 0 || len(n.children) > 0 {
-	walk:
-		for {
-			// Update maxParams of the current node
-			if numParams > n.maxParams {
-				n.maxParams = numParams
-			}
-
-			// Find the longest common prefix.
-			// This also implies that the common prefix contains no ':' or '*'
-			// since the existing key can't contain those chars.
-			i := 0
-			max := min(len(path), len(n.path))
-			for i < max && path[i] == n.path[i] {
-				i++
-			}
-
-			// Split edge
-			if i < len(n.path) {
-				child := node{
-					path:      n.path[i:],
-					wildChild: n.wildChild,
-					nType:     static,
-					indices:   n.indices,
-					children:  n.children,
-					handle:    n.handle,
-					priority:  n.priority - 1,
-				}
+// adds a wildcard child, keeping the param children with a constraint in
+// front of the one without and a catchAll child last
+func (n *node) addWildChild(child *node) {
+	n.wildChild = true
+	pos := len(n.children)
+	if child.nType == param {
+		for pos > len(n.indices) {
+			prev := n.children[pos-1]
+			if prev.nType == param && (prev.constraint != nil || child.constraint == nil) {
+				break
+			}
+			pos--
+		}
+	}
+	n.children = append(n.children, nil)
+	copy(n.children[pos+1:], n.children[pos:])
+	n.children[pos] = child
+}
 
-				// Update maxParams (max of all children)
-				for i := range child.children {
-					if child.children[i].maxParams > child.maxParams {
-						child.maxParams = child.children[i].maxParams
-					}
-				}
+// returns the param child with the given constraint, or nil
+func (n *node) paramChild(pc *paramConstraint) *node {
+	if n.wildChild {
+		for _, child := range n.children[len(n.indices):] {
+			if child.nType == param && child.constraint == pc {
+				return child
+			}
+		}
+	}
+	return nil
+}
+
+// returns the wildcard as it was registered, including the constraint
+func (n *node) wildcard() string {
+	if n.constraint != nil {
+		return n.path + "<" + n.constraint.expr + ">"
+	}
+	return n.path
+}
 
-				n.children = []*node{&child}
-				// []byte for proper unicode char conversion, see #65
-				n.indices = string([]byte{n.path[i]})
-				n.path = path[:i]
-				n.handle = nil
-				n.wildChild = false
+// returns the first wildcard child of the given type, or nil
+func (n *node) wildcardChild(nType nodeType) *node {
+	if n.wildChild {
+		for _, child := range n.children[len(n.indices):] {
+			if child.nType == nType {
+				return child
 			}
+		}
+	}
+	return nil
+}
 
-			// Make new node a child of this node
-			if i < len(path) {
-				path = path[i:]
+// reports whether n holds a handle for the method. The method is empty in the
+// tree of a single method, where any handle counts.
+func (n *node) holds(method string) bool {
+	return n.handle != nil && (len(method) == 0 || n.methods.has(method))
+}
 
-				if n.wildChild {
-					n = n.children[0]
-					n.priority++
+// reports whether n has a catchAll child holding a handle for the method
+func (n *node) catchAllHolds(method string) bool {
+	child := n.wildcardChild(catchAll)
+	return child != nil && child.holds(method)
+}
 
-					// Update maxParams of the child node
-					if numParams > n.maxParams {
-						n.maxParams = numParams
-					}
-					numParams--
+// reports whether n matches its own path followed by a '/', either with a
+// static child or with a catchAll child
+func (n *node) hasSlashLeaf(method string) bool {
+	for i := 0; i < len(n.indices); i++ {
+		if n.indices[i] == '/' {
+			child := n.children[i]
+			return child.path == "/" && (child.holds(method) || child.catchAllHolds(method))
+		}
+	}
+	return false
+}
 
-					// Check if the wildcard matches
-					if len(path) >= len(n.path) && n.path == path[:len(n.path)] &&
-						// Check for longer wildcard, e.g. :name and :names
-						(len(n.path) >= len(path) || path[len(n.path)] == '/') {
-						continue walk
-					} else {
-						// Wildcard conflict
-						var pathSeg string
-						if n.nType == catchAll {
-							pathSeg = path
-						} else {
-							pathSeg = strings.SplitN(path, "/", 2)[0]
-						}
-						prefix := fullPath[:strings.Index(fullPath, pathSeg)] + n.path
-						panic("'" + pathSeg +
-							"' in new path '" + fullPath +
-							"' conflicts with existing wildcard '" + n.path +
-							"' in existing prefix '" + prefix +
-							"'")
-					}
-				}
+// checkPath checks the wildcards of a path to be registered, and returns an
+// *InvalidPatternError if they are invalid.
+func checkPath(path string) error {
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c != ':' && c != '*' {
+			continue
+		}
 
-				c := path[0]
+		// find wildcard end (either '/' or path end)
+		nameEnd, end := wildcardEnd(path, i)
 
-				// slash after param
-				if n.nType == param && c == '/' && len(n.children) == 1 {
-					n = n.children[0]
-					n.priority++
-					continue walk
+		// the wildcard name must not contain ':' and '*'
+		if j := strings.IndexAny(path[i+1:nameEnd], ":*"); j >= 0 {
+			return newInvalidPatternError(path, i+1+j,
+				"only one wildcard per path segment is allowed, has: '"+path[i:]+"'")
+		}
+
+		// check if the wildcard has a name
+		if nameEnd-i < 2 {
+			return newInvalidPatternError(path, i, "wildcards must be named with a non-empty name")
+		}
+
+		// check the constraint, if any
+		if end != nameEnd {
+			if c == '*' {
+				return newInvalidPatternError(path, nameEnd, "catch-all routes can't have a constraint")
+			}
+			if end < 0 {
+				return newInvalidPatternError(path, nameEnd, "unterminated constraint")
+			}
+			if end-nameEnd < 3 {
+				return newInvalidPatternError(path, nameEnd, "constraints must not be empty")
+			}
+			if end < len(path) && path[end] != '/' {
+				return newInvalidPatternError(path, end, "constraints are only allowed at the end of a path segment")
+			}
+			if _, err := lookupConstraint(path[nameEnd+1 : end-1]); err != nil {
+				return newInvalidPatternError(path, nameEnd+1, err.Error())
+			}
+		}
+
+		if c == '*' {
+			if end != len(path) {
+				return newInvalidPatternError(path, i, "catch-all routes are only allowed at the end of the path")
+			}
+			if path[i-1] != '/' {
+				return newInvalidPatternError(path, i, "no / before catch-all")
+			}
+		}
+
+		i = end
+	}
+	return nil
+}
+
+// checkRoute returns the error adding a route with the path to the tree
+// would fail with, without modifying it: an *InvalidPatternError, a
+// *ConflictError or a *DuplicateRouteError.
+func (n *node) checkRoute(path string) error {
+	if err := checkPath(path); err != nil {
+		return err
+	}
+	fullPath := path
+
+	// Empty tree
+	if len(n.path) == 0 && len(n.children) == 0 {
+		return nil
+	}
+
+walk:
+	for {
+		// Find the longest common prefix.
+		i := 0
+		max := min(len(path), len(n.path))
+		for i < max && path[i] == n.path[i] {
+			i++
+		}
+
+		// The edge would be split, the rest of the path is new
+		if i < len(n.path) {
+			return nil
+		}
+		path = path[i:]
+
+		for {
+			if len(path) == 0 {
+				if n.handle != nil {
+					return &DuplicateRouteError{Path: fullPath}
 				}
+				return nil
+			}
 
-				// Check if a child with the next path byte exists
-				for i := 0; i < len(n.indices); i++ {
-					if c == n.indices[i] {
-						i = n.incrementChildPrio(i)
-						n = n.children[i]
-						continue walk
-					}
+			c := path[0]
+
+			if c == ':' || c == '*' {
+				var child *node
+				nameEnd, end := len(path), len(path)
+				if c == '*' {
+					child = n.wildcardChild(catchAll)
+				} else {
+					nameEnd, end = wildcardEnd(path, 0)
+					child = n.paramChild(wildcardConstraint(path, nameEnd, end, fullPath))
+				}
+				if child == nil {
+					return nil
 				}
 
-				// Otherwise insert it
-				if c != ':' && c != '*' {
-					// []byte for proper unicode char conversion, see #65
-					n.indices += string([]byte{c})
-					child := &node{
-						maxParams: numParams,
+				// Check if the wildcard matches
+				if child.path != path[:nameEnd] {
+					return &ConflictError{
+						Path:     fullPath,
+						Existing: child.anyRoute(),
+						Segment:  path[:end],
+						Wildcard: child.wildcard(),
 					}
-					n.children = append(n.children, child)
-					n.incrementChildPrio(len(n.indices) - 1)
-					n = child
 				}
-				n.insertChild(numParams, path, fullPath, handle)
-				return
 
-			} else if i == len(path) { // Make node a (in-path) leaf
-				if n.handle != nil {
-					panic("a handle is already registered for path '" + fullPath + "'")
+				n = child
+				path = path[end:]
+				continue
+			}
+
+			for i := 0; i < len(n.indices); i++ {
+				if c == n.indices[i] {
+					n = n.children[i]
+					continue walk
 				}
-				n.handle = handle
 			}
-			return
+			return nil
 		}
-	} else { // Empty tree
+	}
+}
+
+// anyRoute returns the path of a route registered at or below n.
+func (n *node) anyRoute() string {
+	for n.handle == nil && len(n.children) > 0 {
+		n = n.children[0]
+	}
+	return n.fullPath
+}
+
+// addRoute adds a node with the given handle to the path. It panics with the
+// error of checkRoute, if any, before modifying the tree.
+// Not concurrency-safe!
+func (n *node) addRoute(path string, handle Handle) {
+	if err := n.checkRoute(path); err != nil {
+		panic(err.Error())
+	}
+
+	fullPath := path
+	n.priority++
+	numParams := countParams(path)
+
+	// Empty tree
+	if len(n.path) == 0 && len(n.children) == 0 {
+		n.maxParams = numParams
 		n.insertChild(numParams, path, fullPath, handle)
 		n.nType = root
+		return
 	}
-}
 
-func (n *node) insertChild(numParams uint8, path, fullPath string, handle Handle) {
-	var offset int // already handled bytes of the path
+walk:
+	for {
+		// Update maxParams of the current node
+		if numParams > n.maxParams {
+			n.maxParams = numParams
+		}
 
-	// find prefix until first wildcard (beginning with ':'' or '*'')
-	for i, max := 0, len(path); numParams > 0; i++ {
-		c := path[i]
-		if c != ':' && c != '*' {
-			continue
+		// Find the longest common prefix.
+		// This also implies that the common prefix contains no ':' or '*'
+		// since the path of a static node can't contain those chars.
+		i := 0
+		max := min(len(path), len(n.path))
+		for i < max && path[i] == n.path[i] {
+			i++
 		}
 
-		// find wildcard end (either '/' or path end)
-		end := i + 1
-		for end < max && path[end] != '/' {
-			switch path[end] {
-			// the wildcard name must not contain ':' and '*'
-			case ':', '*':
-				panic("only one wildcard per path segment is allowed, has: '" +
-					path[i:] + "' in path '" + fullPath + "'")
-			default:
-				end++
+		// Split edge
+		if i < len(n.path) {
+			child := node{
+				path:      n.path[i:],
+				wildChild: n.wildChild,
+				nType:     static,
+				indices:   n.indices,
+				children:  n.children,
+				handle:    n.handle,
+				priority:  n.priority - 1,
+				fullPath:  n.fullPath,
+				methods:   n.methods,
 			}
-		}
 
-		// check if this Node existing children which would be
-		// unreachable if we insert the wildcard here
-		if len(n.children) > 0 {
-			panic("wildcard route '" + path[i:end] +
-				"' conflicts with existing children in path '" + fullPath + "'")
-		}
+			// Update maxParams (max of all children)
+			for i := range child.children {
+				if child.children[i].maxParams > child.maxParams {
+					child.maxParams = child.children[i].maxParams
+				}
+			}
 
-		// check if the wildcard has a name
-		if end-i < 2 {
-			panic("wildcards must be named with a non-empty name in path '" + fullPath + "'")
+			n.children = []*node{&child}
+			// []byte for proper unicode char conversion, see #65
+			n.indices = string([]byte{n.path[i]})
+			n.path = path[:i]
+			n.handle = nil
+			n.fullPath = ""
+			n.methods = nil
+			n.wildChild = false
 		}
+		path = path[i:]
 
-		if c == ':' { // param
-			// split path at the beginning of the wildcard
-			if i > 0 {
-				n.path = path[offset:i]
-				offset = i
+		// The path of n is fully consumed, continue with its children.
+		// A wildcard child is entered right here, since its path is not split.
+		for {
+			// Make node a (in-path) leaf
+			if len(path) == 0 {
+				if n.handle != nil {
+					panic("a handle is already registered for path '" + fullPath + "'")
+				}
+				n.handle = handle
+				n.fullPath = fullPath
+				return
 			}
 
-			child := &node{
-				nType:     param,
-				maxParams: numParams,
-			}
-			n.children = []*node{child}
-			n.wildChild = true
-			n = child
-			n.priority++
-			numParams--
-
-			// if the path doesn't end with the wildcard, then there
-			// will be another non-wildcard subpath starting with '/'
-			if end < max {
-				n.path = path[offset:end]
-				offset = end
-
-				child := &node{
-					maxParams: numParams,
-					priority:  1,
+			c := path[0]
+
+			if c == ':' || c == '*' {
+				var child *node
+				var pc *paramConstraint
+				nType, nameEnd, end := catchAll, len(path), len(path)
+				if c == '*' {
+					child = n.wildcardChild(catchAll)
+				} else {
+					nType = param
+					nameEnd, end = wildcardEnd(path, 0)
+					pc = wildcardConstraint(path, nameEnd, end, fullPath)
+					child = n.paramChild(pc)
+				}
+
+				if child == nil {
+					child = &node{
+						nType:      nType,
+						maxParams:  numParams,
+						priority:   1,
+						constraint: pc,
+					}
+					n.addWildChild(child)
+					child.insertChild(numParams, path, fullPath, handle)
+					return
+				}
+
+				// Check if the wildcard matches
+				if child.path != path[:nameEnd] {
+					// Wildcard conflict
+					pathSeg := path[:end]
+					prefix := fullPath[:strings.Index(fullPath, pathSeg)] + child.wildcard()
+					panic("'" + pathSeg +
+						"' in new path '" + fullPath +
+						"' conflicts with existing wildcard '" + child.wildcard() +
+						"' in existing prefix '" + prefix +
+						"'")
 				}
-				n.children = []*node{child}
+
 				n = child
-			}
+				n.priority++
+
+				// Update maxParams of the child node
+				if numParams > n.maxParams {
+					n.maxParams = numParams
+				}
+				numParams--
 
-		} else { // catchAll
-			if end != max || numParams > 1 {
-				panic("catch-all routes are only allowed at the end of the path in path '" + fullPath + "'")
+				path = path[end:]
+				continue
 			}
 
-			if len(n.path) > 0 && n.path[len(n.path)-1] == '/' {
-				panic("catch-all conflicts with existing handle for the path segment root in path '" + fullPath + "'")
+			// Check if a static child with the next path byte exists
+			for i := 0; i < len(n.indices); i++ {
+				if c == n.indices[i] {
+					i = n.incrementChildPrio(i)
+					n = n.children[i]
+					continue walk
+				}
 			}
 
-			// currently fixed width 1 for '/'
-			i--
-			if path[i] != '/' {
-				panic("no / before catch-all in path '" + fullPath + "'")
+			// Otherwise insert it
+			child := &node{
+				maxParams: numParams,
 			}
+			n.addStaticChild(c, child)
+			child.insertChild(numParams, path, fullPath, handle)
+			return
+		}
+	}
+}
+
+// insertChild fills the empty node n with the given path, creating a chain of
+// nodes below n for each wildcard. If path begins with a wildcard, n must be of
+// the matching wildcard type already.
+func (n *node) insertChild(numParams uint8, path, fullPath string, handle Handle) {
+	for {
+		// find prefix until first wildcard (beginning with ':' or '*')
+		i := strings.IndexAny(path, ":*")
+		if i < 0 {
+			break
+		}
 
-			n.path = path[offset:i]
+		if i > 0 {
+			n.path = path[:i]
+			path = path[i:]
 
-			// first node: catchAll node with empty path
-			child := &node{
-				wildChild: true,
-				nType:     catchAll,
-				maxParams: 1,
+			nType := param
+			if path[0] == '*' {
+				nType = catchAll
 			}
-			n.children = []*node{child}
-			n.indices = string(path[i])
-			n = child
-			n.priority++
-
-			// second node: node holding the variable
-			child = &node{
-				path:      path[i:],
-				nType:     catchAll,
-				maxParams: 1,
-				handle:    handle,
+			child := &node{
+				nType:     nType,
+				maxParams: numParams,
 				priority:  1,
 			}
-			n.children = []*node{child}
+			n.addWildChild(child)
+			n = child
+		}
 
+		if n.nType == catchAll {
+			// the catch-all always ends the path
+			break
+		}
+
+		// find param end (either '/' or path end)
+		nameEnd, end := wildcardEnd(path, 0)
+		n.path = path[:nameEnd]
+		n.constraint = wildcardConstraint(path, nameEnd, end, fullPath)
+		numParams--
+
+		// if the path doesn't end with the wildcard, then there
+		// will be another non-wildcard subpath starting with '/'
+		if end == len(path) {
+			n.handle = handle
+			n.fullPath = fullPath
 			return
 		}
+		path = path[end:]
+
+		child := &node{
+			maxParams: numParams,
+			priority:  1,
+		}
+		n.indices = string([]byte{path[0]})
+		n.children = []*node{child}
+		n = child
 	}
 
 	// insert remaining path part and handle to the leaf
-	n.path = path[offset:]
+	n.path = path
 	n.handle = handle
+	n.fullPath = fullPath
+}
+
+// removeRoute removes the handle registered with the given path, as it was
+// registered, and reports whether there was one.
+// Nodes left without a handle and children are removed, and a static node
+// left without a handle and with a single static child is merged with it, so
+// that the tree looks as if the path had never been added.
+// Not concurrency-safe!
+func (n *node) removeRoute(path string) bool {
+	if !n.removePath(path) {
+		return false
+	}
+
+	// Empty tree
+	if n.handle == nil && len(n.children) == 0 {
+		*n = node{}
+	}
+	return true
+}
+
+// removes the handle of the path below n, the path beginning with the path
+// (or the wildcard) of n
+func (n *node) removePath(path string) bool {
+	switch n.nType {
+	case param:
+		_, end := wildcardEnd(path, 0)
+		path = path[end:]
+	case catchAll:
+		path = ""
+	default:
+		if len(path) < len(n.path) || path[:len(n.path)] != n.path {
+			return false
+		}
+		path = path[len(n.path):]
+	}
+
+	if len(path) == 0 {
+		if n.handle == nil {
+			return false
+		}
+		n.handle = nil
+		n.fullPath = ""
+	} else {
+		pos := n.childFor(path)
+		if pos < 0 {
+			return false
+		}
+		child := n.children[pos]
+		if !child.removePath(path) {
+			return false
+		}
+		if child.handle == nil && len(child.children) == 0 {
+			n.removeChild(pos)
+		} else if pos < len(n.indices) {
+			n.decrementChildPrio(pos)
+		}
+	}
+
+	n.priority--
+	n.updateMaxParams()
+	n.mergeChild()
+	return true
+}
+
+// findRoute returns the node holding the handle registered with the given
+// path, as it was registered, or nil.
+func (n *node) findRoute(path string) *node {
+	if n = n.findNode(path); n == nil || n.handle == nil {
+		return nil
+	}
+	return n
+}
+
+// findNode returns the node the given path, as it was registered, ends with,
+// whether it holds a handle or not, or nil.
+func (n *node) findNode(path string) *node {
+	for {
+		switch n.nType {
+		case param:
+			_, end := wildcardEnd(path, 0)
+			path = path[end:]
+		case catchAll:
+			path = ""
+		default:
+			if len(path) < len(n.path) || path[:len(n.path)] != n.path {
+				return nil
+			}
+			path = path[len(n.path):]
+		}
+
+		if len(path) == 0 {
+			return n
+		}
+		pos := n.childFor(path)
+		if pos < 0 {
+			return nil
+		}
+		n = n.children[pos]
+	}
+}
+
+// returns the position of the child the registered path continues with, or -1
+func (n *node) childFor(path string) int {
+	switch path[0] {
+	case ':':
+		_, end := wildcardEnd(path, 0)
+		if end < 0 {
+			return -1
+		}
+		for i := len(n.indices); i < len(n.children); i++ {
+			if child := n.children[i]; child.nType == param && child.wildcard() == path[:end] {
+				return i
+			}
+		}
+	case '*':
+		for i := len(n.indices); i < len(n.children); i++ {
+			if child := n.children[i]; child.nType == catchAll && child.path == path {
+				return i
+			}
+		}
+	default:
+		for i := 0; i < len(n.indices); i++ {
+			if n.indices[i] == path[0] {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// removes the child at the given position
+func (n *node) removeChild(pos int) {
+	if pos < len(n.indices) {
+		n.indices = n.indices[:pos] + n.indices[pos+1:]
+	}
+	last := len(n.children) - 1
+	copy(n.children[pos:], n.children[pos+1:])
+	n.children[last] = nil
+	n.children = n.children[:last]
+	n.wildChild = len(n.children) > len(n.indices)
+}
+
+// moves the static child at the given position behind the children with a
+// higher priority, after its priority was decremented
+func (n *node) decrementChildPrio(pos int) {
+	prio := n.children[pos].priority
+
+	newPos := pos
+	for newPos < len(n.indices)-1 && n.children[newPos+1].priority > prio {
+		// swap node positions
+		n.children[newPos+1], n.children[newPos] = n.children[newPos], n.children[newPos+1]
+
+		newPos++
+	}
+
+	// build new index char string
+	if newPos != pos {
+		n.indices = n.indices[:pos] + // unchanged prefix, might be empty
+			n.indices[pos+1:newPos+1] + // the chars moved to the front
+			n.indices[pos:pos+1] + // the index char we move
+			n.indices[newPos+1:] // unchanged rest, might be empty
+	}
+}
+
+// recomputes maxParams from the children of n
+func (n *node) updateMaxParams() {
+	var maxParams uint8
+	for _, child := range n.children {
+		if child.maxParams > maxParams {
+			maxParams = child.maxParams
+		}
+	}
+	if (n.nType == param || n.nType == catchAll) && maxParams < 255 {
+		maxParams++
+	}
+	n.maxParams = maxParams
+}
+
+// merges the static (or root) node n without a handle with its child, if it
+// is the only one and static as well
+func (n *node) mergeChild() {
+	if n.nType > root || n.handle != nil || len(n.children) != 1 || n.wildChild {
+		return
+	}
+
+	// the priority and maxParams of n are the ones of the child already
+	child := n.children[0]
+	n.path += child.path
+	n.wildChild = child.wildChild
+	n.indices = child.indices
+	n.children = child.children
+	n.handle = child.handle
+	n.fullPath = child.fullPath
+	n.methods = child.methods
+}
+
+// clone returns a deep copy of the tree below n. The handles and constraints
+// are shared with n.
+func (n *node) clone() *node {
+	c := *n
+	if len(n.children) > 0 {
+		c.children = make([]*node, len(n.children))
+		for i, child := range n.children {
+			c.children[i] = child.clone()
+		}
+	}
+	return &c
+}
+
+// walk calls fn for n and every node below n holding a handle, depth-first in
+// the order of the children. It stops at the first error returned by fn.
+func (n *node) walk(fn func(*node) error) error {
+	if n.handle != nil {
+		if err := fn(n); err != nil {
+			return err
+		}
+	}
+	for _, child := range n.children {
+		if err := child.walk(fn); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // Returns the handle registered with the given path (key). The values of
@@ -330,329 +817,526 @@ func (n *node) insertChild(numParams uint8, path, fullPath string, handle Handle
 // made if a handle exists with an extra (without the) trailing slash for the
 // given path.
 func (n *node) getValue(path string) (handle Handle, p Params, tsr bool) {
-walk: // outer loop for walking the tree
+	leaf, p, tsr := n.getLeaf(path, nil)
+	if leaf != nil {
+		handle = leaf.handle
+	}
+	return
+}
+
+// Like getValue, but returns the node holding the handle instead, which also
+// carries the full path the handle was registered with. The values of
+// wildcards are appended to p, if it isn't nil.
+//
+// Static children take precedence over a param child, which takes precedence
+// over a catchAll child. If the path can't be matched below a child, the next
+// one is tried.
+//
+// This is the lookup in the tree of a single method. The nodes with a single
+// child to walk into are walked like in a tree without alternatives, only at
+// a node with alternatives to return to on failure the lookup is continued by
+// getStaticLeaf.
+func (n *node) getLeaf(path string, p Params) (leaf *node, ps Params, tsr bool) {
+	ps = p
+
+	// the node walked down from, if any
+	var parent *node
+
+walk: // outer loop for walking down the static nodes
 	for {
-		if len(path) > len(n.path) {
-			if path[:len(n.path)] == n.path {
-				path = path[len(n.path):]
-				// If this node does not have a wildcard (param or catchAll)
-				// child,  we can just look up the next child node and continue
-				// to walk down the tree
-				if !n.wildChild {
-					c := path[0]
-					for i := 0; i < len(n.indices); i++ {
-						if c == n.indices[i] {
-							n = n.children[i]
-							continue walk
-						}
+		prefix := n.path
+		if len(path) > len(prefix) && path[:len(prefix)] == prefix {
+			rest := path[len(prefix):]
+
+			if !n.wildChild {
+				c := rest[0]
+				for i := 0; i < len(n.indices); i++ {
+					if c == n.indices[i] {
+						parent = n
+						n = n.children[i]
+						path = rest
+						continue walk
 					}
+				}
 
-					// Nothing found.
-					// We can recommend to redirect to the same URL without a
-					// trailing slash if a leaf exists for that path.
-					tsr = (path == "/" && n.handle != nil)
-					return
+				// Nothing found.
+				// We can recommend to redirect to the same URL without a
+				// trailing slash if a leaf exists for that path.
+				tsr = rest == "/" && n.handle != nil
+				return
+			}
 
-				}
+			if len(n.indices) > 0 || len(n.children) > 1 {
+				return n.getStaticLeaf(path, ps, "", nil)
+			}
 
-				// handle wildcard child
-				n = n.children[0]
-				switch n.nType {
-				case param:
-					// find param end (either '/' or path end)
-					end := 0
-					for end < len(path) && path[end] != '/' {
-						end++
-					}
+			// handle the wildcard child
+			child := n.children[0]
+			switch child.nType {
+			case param:
+				// walked into below
+			case catchAll:
+				// save param value, which begins with the '/' the path of n
+				// ends with
+				if ps == nil {
+					// lazy allocation
+					ps = make(Params, 0, child.maxParams)
+				}
+				ps = append(ps, Param{Key: child.path[1:], Value: path[len(prefix)-1:]})
 
-					// save param value
-					if p == nil {
-						// lazy allocation
-						p = make(Params, 0, n.maxParams)
-					}
-					i := len(p)
-					p = p[:i+1] // expand slice within preallocated capacity
-					p[i].Key = n.path[1:]
-					p[i].Value = path[:end]
-
-					// we need to go deeper!
-					if end < len(path) {
-						if len(n.children) > 0 {
-							path = path[end:]
-							n = n.children[0]
-							continue walk
-						}
-
-						// ... but we can't
-						tsr = (len(path) == end+1)
-						return
-					}
+				if child.handle != nil {
+					return child, ps, false
+				}
+				tsr = rest == "/" && n.handle != nil
+				return
+			default:
+				panic("invalid node type")
+			}
 
-					if handle = n.handle; handle != nil {
-						return
-					} else if len(n.children) == 1 {
-						// No handle found. Check if a handle for this path + a
-						// trailing slash exists for TSR recommendation
-						n = n.children[0]
-						tsr = (n.path == "/" && n.handle != nil)
-					}
+			// find param end (either '/' or path end)
+			end := 0
+			for end < len(rest) && rest[end] != '/' {
+				end++
+			}
+			if end == 0 || (child.constraint != nil && !child.constraint.match(rest[:end])) {
+				tsr = rest == "/" && n.handle != nil
+				return
+			}
 
-					return
+			// save param value
+			if ps == nil {
+				// lazy allocation
+				ps = make(Params, 0, child.maxParams)
+			}
+			ps = append(ps, Param{Key: child.path[1:], Value: rest[:end]})
 
-				case catchAll:
-					// save param value
-					if p == nil {
-						// lazy allocation
-						p = make(Params, 0, n.maxParams)
-					}
-					i := len(p)
-					p = p[:i+1] // expand slice within preallocated capacity
-					p[i].Key = n.path[2:]
-					p[i].Value = path
+			if end == len(rest) {
+				if child.handle != nil {
+					return child, ps, false
+				}
 
-					handle = n.handle
-					return
+				// No handle found. Check if a handle for this path + a
+				// trailing slash exists for TSR recommendation
+				tsr = child.hasSlashLeaf("")
+				return
+			}
 
-				default:
-					panic("invalid node type")
+			// we need to go deeper!
+			rest = rest[end:]
+			for i := 0; i < len(child.indices); i++ {
+				if rest[0] == child.indices[i] {
+					parent = child
+					n = child.children[i]
+					path = rest
+					continue walk
 				}
 			}
-		} else if path == n.path {
+
+			// ... but we can't
+			tsr = rest == "/" && child.handle != nil
+			return
+		}
+
+		if len(path) == len(prefix) && path == prefix {
 			// We should have reached the node containing the handle.
 			// Check if this node has a handle registered.
-			if handle = n.handle; handle != nil {
-				return
+			if n.handle != nil {
+				return n, ps, false
 			}
 
-			if path == "/" && n.wildChild && n.nType != root {
-				tsr = true
-				return
+			// A catchAll child also matches the path segment root
+			if child := n.wildcardChild(catchAll); child != nil && child.handle != nil {
+				return child.getCatchAllLeaf(path[len(path)-1:], ps, "", nil)
 			}
 
 			// No handle found. Check if a handle for this path + a
 			// trailing slash exists for trailing slash recommendation
+			tsr = n.hasSlashLeaf("") ||
+				(path == "/" && parent != nil && parent.handle != nil)
+			return
+		}
+
+		// Nothing found. We can recommend to redirect to the same URL with an
+		// extra trailing slash if a leaf exists for that path, or without the
+		// trailing slash if the parent is a leaf.
+		tsr = (path == "/" && parent != nil && parent.handle != nil) ||
+			(len(prefix) == len(path)+1 && prefix[len(path)] == '/' &&
+				path == prefix[:len(path)] &&
+				(n.handle != nil || n.catchAllHolds("")))
+		return
+	}
+}
+
+// lookup below the static (or root) node n
+//
+// Only alternatives which have to be returned to on failure are looked up
+// recursively, the last one at each node is walked into directly.
+//
+// In the tree of the paths of all methods, the methods of the leaves matching
+// the path but not holding a handle for the method are added to m, if not nil.
+// Unless a leaf is found, these are all leaves matching the path then.
+func (n *node) getStaticLeaf(path string, p Params, method string, m *methodMatch) (leaf *node, ps Params, tsr bool) {
+	ps = p
+
+	// the node walked down from, if any
+	var parent *node
+
+walk: // outer loop for walking down the static nodes
+	for {
+		prefix := n.path
+		if len(path) < len(prefix) || path[:len(prefix)] != prefix {
+			// Nothing found. We can recommend to redirect to the same URL with
+			// an extra trailing slash if a leaf exists for that path, or
+			// without the trailing slash if the parent is a leaf.
+			tsr = tsr || (path == "/" && parent != nil && parent.holds(method)) ||
+				(len(prefix) == len(path)+1 && prefix[len(path)] == '/' &&
+					path == prefix[:len(path)] &&
+					(n.holds(method) || n.catchAllHolds(method)))
+			return
+		}
+
+		if len(path) == len(prefix) {
+			// We should have reached the node containing the handle.
+			// Check if this node has a handle registered.
+			if n.holds(method) {
+				return n, ps, false
+			}
+			m.add(n.methods)
+
+			// A catchAll child also matches the path segment root
+			if child := n.wildcardChild(catchAll); child != nil {
+				if child.holds(method) {
+					return child.getCatchAllLeaf(path[len(path)-1:], ps, method, m)
+				}
+				m.add(child.methods)
+			}
+
+			// No handle found. Check if a handle for this path + a
+			// trailing slash exists for trailing slash recommendation
+			tsr = tsr || n.hasSlashLeaf(method) ||
+				(path == "/" && parent != nil && parent.holds(method))
+			return
+		}
+
+		rest := path[len(prefix):]
+		c := rest[0]
+
+		// If this node does not have a wildcard (param or catchAll) child, we
+		// can just look up the next child node and continue to walk down the
+		// tree, since there is nothing to backtrack to.
+		if !n.wildChild {
 			for i := 0; i < len(n.indices); i++ {
-				if n.indices[i] == '/' {
+				if c == n.indices[i] {
+					parent = n
 					n = n.children[i]
-					tsr = (len(n.path) == 1 && n.handle != nil) ||
-						(n.nType == catchAll && n.children[0].handle != nil)
-					return
+					path = rest
+					continue walk
 				}
 			}
 
+			// Nothing found.
+			// We can recommend to redirect to the same URL without a
+			// trailing slash if a leaf exists for that path.
+			tsr = tsr || (rest == "/" && n.holds(method))
 			return
 		}
 
-		// Nothing found. We can recommend to redirect to the same URL with an
-		// extra trailing slash if a leaf exists for that path
-		tsr = (path == "/") ||
-			(len(n.path) == len(path)+1 && n.path[len(path)] == '/' &&
-				path == n.path[:len(n.path)-1] && n.handle != nil)
+		// We can recommend to redirect to the same URL without a trailing
+		// slash if a leaf exists for that path, unless one is found below.
+		tsr = tsr || (rest == "/" && n.holds(method))
+
+		// Try the static child first, then the wildcard children.
+		// A failed attempt leaves its values in ps, which are overwritten by
+		// the next attempt, or returned along with a TSR recommendation if
+		// there is none.
+		base := len(ps)
+		for i := 0; i < len(n.indices); i++ {
+			if c == n.indices[i] {
+				var childTsr bool
+				if leaf, ps, childTsr = n.children[i].getStaticLeaf(rest, ps, method, m); leaf != nil {
+					return leaf, ps, false
+				}
+				tsr = tsr || childTsr
+				break
+			}
+		}
+
+		// Only the param children before the last wildcard child have to be
+		// returned to on failure; a catchAll child is always the last one.
+		last := len(n.children) - 1
+		for i := len(n.indices); i < last; i++ {
+			var childTsr bool
+			if leaf, ps, childTsr = n.children[i].getParamLeaf(rest, ps[:base], method, m); leaf != nil {
+				return leaf, ps, false
+			}
+			tsr = tsr || childTsr
+		}
+
+		child := n.children[last]
+		switch child.nType {
+		case param:
+			// walked into below
+		case catchAll:
+			// save param value, which begins with the '/' the path of n ends
+			// with
+			ps = ps[:base]
+			if ps == nil {
+				// lazy allocation
+				ps = make(Params, 0, child.maxParams)
+			}
+			ps = append(ps, Param{Key: child.path[1:], Value: path[len(prefix)-1:]})
+
+			if child.holds(method) {
+				return child, ps, false
+			}
+			m.add(child.methods)
+			return
+		default:
+			panic("invalid node type")
+		}
+
+		// find param end (either '/' or path end)
+		end := 0
+		for end < len(rest) && rest[end] != '/' {
+			end++
+		}
+		if end == 0 || (child.constraint != nil && !child.constraint.match(rest[:end])) {
+			return
+		}
+
+		// save param value
+		ps = ps[:base]
+		if ps == nil {
+			// lazy allocation
+			ps = make(Params, 0, child.maxParams)
+		}
+		ps = append(ps, Param{Key: child.path[1:], Value: rest[:end]})
+
+		if end == len(rest) {
+			if child.holds(method) {
+				return child, ps, false
+			}
+			m.add(child.methods)
+
+			// No handle found. Check if a handle for this path + a
+			// trailing slash exists for TSR recommendation
+			tsr = tsr || child.hasSlashLeaf(method)
+			return
+		}
+
+		// we need to go deeper!
+		rest = rest[end:]
+		for i := 0; i < len(child.indices); i++ {
+			if rest[0] == child.indices[i] {
+				parent = child
+				n = child.children[i]
+				path = rest
+				continue walk
+			}
+		}
+
+		// ... but we can't
+		tsr = tsr || (rest == "/" && child.holds(method))
 		return
 	}
 }
 
+// lookup below the param node n
+func (n *node) getParamLeaf(path string, p Params, method string, m *methodMatch) (leaf *node, ps Params, tsr bool) {
+	// find param end (either '/' or path end)
+	end := 0
+	for end < len(path) && path[end] != '/' {
+		end++
+	}
+	if end == 0 || (n.constraint != nil && !n.constraint.match(path[:end])) {
+		return nil, p, false
+	}
+
+	// save param value
+	ps = p
+	if ps == nil {
+		// lazy allocation
+		ps = make(Params, 0, n.maxParams)
+	}
+	ps = append(ps, Param{Key: n.path[1:], Value: path[:end]})
+
+	if end == len(path) {
+		if n.holds(method) {
+			return n, ps, false
+		}
+		m.add(n.methods)
+
+		// No handle found. Check if a handle for this path + a
+		// trailing slash exists for TSR recommendation
+		tsr = n.hasSlashLeaf(method)
+		return
+	}
+
+	// we need to go deeper!
+	rest := path[end:]
+	for i := 0; i < len(n.indices); i++ {
+		if rest[0] == n.indices[i] {
+			if leaf, ps, tsr = n.children[i].getStaticLeaf(rest, ps, method, m); leaf != nil {
+				return
+			}
+			break
+		}
+	}
+
+	// ... but we can't
+	tsr = tsr || (rest == "/" && n.holds(method))
+	return
+}
+
+// match of the catchAll node n, the path includes the leading '/'
+func (n *node) getCatchAllLeaf(path string, p Params, method string, m *methodMatch) (leaf *node, ps Params, tsr bool) {
+	// save param value
+	ps = p
+	if ps == nil {
+		// lazy allocation
+		ps = make(Params, 0, n.maxParams)
+	}
+	ps = append(ps, Param{Key: n.path[1:], Value: path})
+
+	if n.holds(method) {
+		leaf = n
+	} else {
+		m.add(n.methods)
+	}
+	return
+}
+
 // Makes a case-insensitive lookup of the given path and tries to find a handler.
 // It can optionally also fix trailing slashes.
 // It returns the case-corrected path and a bool indicating whether the lookup
 // was successful.
 func (n *node) findCaseInsensitivePath(path string, fixTrailingSlash bool) (ciPath []byte, found bool) {
+	return n.findMethodCaseInsensitivePath(path, "", fixTrailingSlash)
+}
+
+// Like findCaseInsensitivePath, but for the tree of the paths of all methods,
+// where only the nodes holding a handle for the given method match.
+func (n *node) findMethodCaseInsensitivePath(path, method string, fixTrailingSlash bool) (ciPath []byte, found bool) {
 	return n.findCaseInsensitivePathRec(
+		0,
 		path,
-		strings.ToLower(path),
 		make([]byte, 0, len(path)+1), // preallocate enough memory for new path
-		[4]byte{},                    // empty rune buffer
+		method,
 		fixTrailingSlash,
 	)
 }
 
-// shift bytes in array by n bytes left
-func shiftNRuneBytes(rb [4]byte, n int) [4]byte {
-	switch n {
-	case 0:
-		return rb
-	case 1:
-		return [4]byte{rb[1], rb[2], rb[3], 0}
-	case 2:
-		return [4]byte{rb[2], rb[3]}
-	case 3:
-		return [4]byte{rb[3]}
-	default:
-		return [4]byte{}
+// walks the bytes b from the position off in the path of n on, continuing
+// with the static children where the path of n ends
+func (n *node) walkBytes(off int, b []byte) (*node, int, bool) {
+walk:
+	for _, c := range b {
+		if off == len(n.path) {
+			for i := 0; i < len(n.indices); i++ {
+				if n.indices[i] == c {
+					n, off = n.children[i], 1
+					continue walk
+				}
+			}
+			return nil, 0, false
+		}
+		if n.path[off] != c {
+			return nil, 0, false
+		}
+		off++
 	}
+	return n, off, true
 }
 
 // recursive case-insensitive lookup function used by n.findCaseInsensitivePath
-func (n *node) findCaseInsensitivePathRec(path, loPath string, ciPath []byte, rb [4]byte, fixTrailingSlash bool) ([]byte, bool) {
-	loNPath := strings.ToLower(n.path)
-
-walk: // outer loop for walking the tree
-	for len(loPath) >= len(loNPath) && (len(loNPath) == 0 || loPath[1:len(loNPath)] == loNPath[1:]) {
-		// add common path to result
-		ciPath = append(ciPath, n.path...)
-
-		if path = path[len(n.path):]; len(path) > 0 {
-			loOld := loPath
-			loPath = loPath[len(loNPath):]
-
-			// If this node does not have a wildcard (param or catchAll) child,
-			// we can just look up the next child node and continue to walk down
-			// the tree
-			if !n.wildChild {
-				// skip rune bytes already processed
-				rb = shiftNRuneBytes(rb, len(loNPath))
-
-				if rb[0] != 0 {
-					// old rune not finished
-					for i := 0; i < len(n.indices); i++ {
-						if n.indices[i] == rb[0] {
-							// continue with child node
-							n = n.children[i]
-							loNPath = strings.ToLower(n.path)
-							continue walk
-						}
-					}
-				} else {
-					// process a new rune
-					var rv rune
-
-					// find rune start
-					// runes are up to 4 byte long,
-					// -4 would definitely be another rune
-					var off int
-					for max := min(len(loNPath), 3); off < max; off++ {
-						if i := len(loNPath) - off; utf8.RuneStart(loOld[i]) {
-							// read rune from cached lowercase path
-							rv, _ = utf8.DecodeRuneInString(loOld[i:])
-							break
-						}
-					}
+//
+// The first off bytes of the path of n have already been matched. Since the
+// path of a node may end in the middle of a multi-byte rune, the path is
+// matched rune by rune, trying each case of a rune in turn.
+func (n *node) findCaseInsensitivePathRec(off int, path string, ciPath []byte, method string, fixTrailingSlash bool) ([]byte, bool) {
+	if len(path) == 0 {
+		if off < len(n.path) {
+			// Nothing found.
+			// Try to fix the path by adding a trailing slash
+			if fixTrailingSlash && off == len(n.path)-1 && n.path[off] == '/' &&
+				(n.holds(method) || n.catchAllHolds(method)) {
+				return append(ciPath, '/'), true
+			}
+			return ciPath, false
+		}
 
-					// calculate lowercase bytes of current rune
-					utf8.EncodeRune(rb[:], rv)
-					// skipp already processed bytes
-					rb = shiftNRuneBytes(rb, off)
-
-					for i := 0; i < len(n.indices); i++ {
-						// lowercase matches
-						if n.indices[i] == rb[0] {
-							// must use a recursive approach since both the
-							// uppercase byte and the lowercase byte might exist
-							// as an index
-							if out, found := n.children[i].findCaseInsensitivePathRec(
-								path, loPath, ciPath, rb, fixTrailingSlash,
-							); found {
-								return out, true
-							}
-							break
-						}
-					}
+		// We should have reached the node containing the handle.
+		// Check if this node has a handle registered.
+		if n.holds(method) || n.catchAllHolds(method) {
+			return ciPath, true
+		}
 
-					// same for uppercase rune, if it differs
-					if up := unicode.ToUpper(rv); up != rv {
-						utf8.EncodeRune(rb[:], up)
-						rb = shiftNRuneBytes(rb, off)
-
-						for i := 0; i < len(n.indices); i++ {
-							// uppercase matches
-							if n.indices[i] == rb[0] {
-								// continue with child node
-								n = n.children[i]
-								loNPath = strings.ToLower(n.path)
-								continue walk
-							}
-						}
-					}
-				}
+		// No handle found.
+		// Try to fix the path by adding a trailing slash
+		if fixTrailingSlash && n.hasSlashLeaf(method) {
+			return append(ciPath, '/'), true
+		}
+		return ciPath, false
+	}
 
-				// Nothing found. We can recommend to redirect to the same URL
-				// without a trailing slash if a leaf exists for that path
-				return ciPath, (fixTrailingSlash && path == "/" && n.handle != nil)
+	// Try all cases of the next rune with the static nodes
+	rv, size := utf8.DecodeRuneInString(path)
+	lo := unicode.ToLower(rv)
+	up := unicode.ToUpper(rv)
+	var buf [utf8.UTFMax]byte
+	for i, r := range [...]rune{lo, up, rv} {
+		if (i == 1 && r == lo) || (i == 2 && (r == lo || r == up)) {
+			continue
+		}
+		k := utf8.EncodeRune(buf[:], r)
+		if next, nextOff, ok := n.walkBytes(off, buf[:k]); ok {
+			if out, found := next.findCaseInsensitivePathRec(
+				nextOff, path[size:], append(ciPath, buf[:k]...), method, fixTrailingSlash,
+			); found {
+				return out, true
 			}
+		}
+	}
+
+	if off < len(n.path) {
+		return ciPath, false
+	}
 
-			n = n.children[0]
-			switch n.nType {
+	if n.wildChild {
+		for _, child := range n.children[len(n.indices):] {
+			switch child.nType {
 			case param:
 				// find param end (either '/' or path end)
 				k := 0
 				for k < len(path) && path[k] != '/' {
 					k++
 				}
-
-				// add param value to case insensitive path
-				ciPath = append(ciPath, path[:k]...)
-
-				// we need to go deeper!
-				if k < len(path) {
-					if len(n.children) > 0 {
-						// continue with child node
-						n = n.children[0]
-						loNPath = strings.ToLower(n.path)
-						loPath = loPath[k:]
-						path = path[k:]
-						continue
-					}
-
-					// ... but we can't
-					if fixTrailingSlash && len(path) == k+1 {
-						return ciPath, true
-					}
-					return ciPath, false
+				if k == 0 || (child.constraint != nil && !child.constraint.match(path[:k])) {
+					continue
 				}
 
-				if n.handle != nil {
-					return ciPath, true
-				} else if fixTrailingSlash && len(n.children) == 1 {
-					// No handle found. Check if a handle for this path + a
-					// trailing slash exists
-					n = n.children[0]
-					if n.path == "/" && n.handle != nil {
-						return append(ciPath, '/'), true
-					}
+				// add param value to case insensitive path
+				if out, found := child.findCaseInsensitivePathRec(
+					len(child.path), path[k:], append(ciPath, path[:k]...), method, fixTrailingSlash,
+				); found {
+					return out, true
 				}
-				return ciPath, false
 
 			case catchAll:
-				return append(ciPath, path...), true
+				if child.holds(method) {
+					return append(ciPath, path...), true
+				}
 
 			default:
 				panic("invalid node type")
 			}
-		} else {
-			// We should have reached the node containing the handle.
-			// Check if this node has a handle registered.
-			if n.handle != nil {
-				return ciPath, true
-			}
-
-			// No handle found.
-			// Try to fix the path by adding a trailing slash
-			if fixTrailingSlash {
-				for i := 0; i < len(n.indices); i++ {
-					if n.indices[i] == '/' {
-						n = n.children[i]
-						if (len(n.path) == 1 && n.handle != nil) ||
-							(n.nType == catchAll && n.children[0].handle != nil) {
-							return append(ciPath, '/'), true
-						}
-						return ciPath, false
-					}
-				}
-			}
-			return ciPath, false
 		}
 	}
 
 	// Nothing found.
-	// Try to fix the path by adding / removing a trailing slash
-	if fixTrailingSlash {
-		if path == "/" {
-			return ciPath, true
-		}
-		if len(loPath)+1 == len(loNPath) && loNPath[len(loPath)] == '/' &&
-			loPath[1:] == loNPath[1:len(loPath)] && n.handle != nil {
-			return append(ciPath, n.path...), true
-		}
+	// Try to fix the path by removing the trailing slash
+	if fixTrailingSlash && path == "/" && n.holds(method) {
+		return ciPath, true
 	}
 	return ciPath, false
 }
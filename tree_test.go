@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"reflect"
 	"regexp"
+	"sort"
 	"strings"
 	"testing"
 )
@@ -57,6 +58,9 @@ func checkRequests(t *testing.T, tree *node, requests testRequests) {
 			if fakeHandlerValue != request.route {
 				t.Errorf("handle mismatch for route '%s': Wrong handle (%s != %s)", request.path, fakeHandlerValue, request.route)
 			}
+			if leaf, _, _ := tree.getLeaf(request.path, nil); leaf.fullPath != request.route {
+				t.Errorf("full path mismatch for route '%s': Wrong path (%s != %s)", request.path, leaf.fullPath, request.route)
+			}
 		}
 
 		if !reflect.DeepEqual(ps, request.ps) {
@@ -114,6 +118,9 @@ func TestCountParams(t *testing.T) {
 	if countParams(strings.Repeat("/:param", 256)) != 255 {
 		t.Fail()
 	}
+	if countParams("/path/:param1<[:*]+>/static/*catch-all") != 2 {
+		t.Fail()
+	}
 }
 
 func TestTreeAddAndGet(t *testing.T) {
@@ -239,38 +246,275 @@ func testRoutes(t *testing.T, routes []testRoute) {
 func TestTreeWildcardConflict(t *testing.T) {
 	routes := []testRoute{
 		{"/cmd/:tool/:sub", false},
-		{"/cmd/vet", true},
+		{"/cmd/vet", false},
+		{"/cmd/:name", true},
 		{"/src/*filepath", false},
 		{"/src/*filepathx", true},
-		{"/src/", true},
+		{"/src/", false},
 		{"/src1/", false},
-		{"/src1/*filepath", true},
+		{"/src1/*filepath", false},
 		{"/src2*filepath", true},
 		{"/search/:query", false},
-		{"/search/invalid", true},
+		{"/search/invalid", false},
+		{"/search/:q", true},
 		{"/user_:name", false},
-		{"/user_x", true},
+		{"/user_x", false},
 		{"/user_:name", false},
+		{"/user_:id", true},
 		{"/id:id", false},
-		{"/id/:id", true},
+		{"/id/:id", false},
+		{"/num/:id<int>", false},
+		{"/num/:n<uint>", false},
+		{"/num/:n", false},
+		{"/num/:x<int>", true},
+		{"/num/:id<int>/x", false},
 	}
 	testRoutes(t, routes)
 }
 
-func TestTreeChildConflict(t *testing.T) {
-	routes := []testRoute{
-		{"/cmd/vet", false},
-		{"/cmd/:tool/:sub", true},
-		{"/src/AUTHORS", false},
-		{"/src/*filepath", true},
-		{"/user_x", false},
-		{"/user_:name", true},
-		{"/id/:id", false},
-		{"/id:id", true},
-		{"/:id", true},
-		{"/*filepath", true},
+func TestTreeChildPrecedence(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/",
+		"/cmd/vet",
+		"/cmd/:tool/:sub",
+		"/cmd/:tool/",
+		"/src/AUTHORS",
+		"/src/:file",
+		"/src/*filepath",
+		"/user_x",
+		"/user_:name",
+		"/id/:id",
+		"/id:id",
+		"/:id",
+		"/*filepath",
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.addRoute(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	//printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/", false, "/", nil},
+		{"/cmd/vet", false, "/cmd/vet", nil},
+		{"/cmd/vet/", false, "/cmd/:tool/", Params{Param{"tool", "vet"}}},
+		{"/cmd/vet/x", false, "/cmd/:tool/:sub", Params{Param{"tool", "vet"}, Param{"sub", "x"}}},
+		{"/cmd/go/", false, "/cmd/:tool/", Params{Param{"tool", "go"}}},
+		{"/cmd", false, "/:id", Params{Param{"id", "cmd"}}},
+		{"/src/AUTHORS", false, "/src/AUTHORS", nil},
+		{"/src/LICENSE", false, "/src/:file", Params{Param{"file", "LICENSE"}}},
+		{"/src/AUTHORS/x", false, "/src/*filepath", Params{Param{"filepath", "/AUTHORS/x"}}},
+		{"/src/", false, "/src/*filepath", Params{Param{"filepath", "/"}}},
+		{"/user_x", false, "/user_x", nil},
+		{"/user_gopher", false, "/user_:name", Params{Param{"name", "gopher"}}},
+		{"/id/5", false, "/id/:id", Params{Param{"id", "5"}}},
+		{"/id5", false, "/id:id", Params{Param{"id", "5"}}},
+		{"/gopher", false, "/:id", Params{Param{"id", "gopher"}}},
+		{"/gopher/x", false, "/*filepath", Params{Param{"filepath", "/gopher/x"}}},
+		{"/id/5/x", false, "/*filepath", Params{Param{"filepath", "/id/5/x"}}},
+	})
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+}
+
+func TestTreeConstraints(t *testing.T) {
+	tree := &node{}
+
+	routes := [...]string{
+		"/user/new",
+		"/user/:id<int>",
+		"/user/:uuid<uuid>",
+		"/user/:name",
+		"/user/:id<int>/posts",
+		"/post/:slug<[a-z0-9-]+>",
+		"/post/*path",
+		"/tag/:tag<[^/]+>/:page<\\d{1,3}>",
+		"/v:major<int>/info",
+	}
+	for _, route := range routes {
+		recv := catchPanic(func() {
+			tree.addRoute(route, fakeHandler(route))
+		})
+		if recv != nil {
+			t.Fatalf("panic inserting route '%s': %v", route, recv)
+		}
+	}
+
+	//printChildren(tree, "")
+
+	checkRequests(t, tree, testRequests{
+		{"/user/new", false, "/user/new", nil},
+		{"/user/42", false, "/user/:id<int>", Params{Param{"id", "42"}}},
+		{"/user/-1", false, "/user/:id<int>", Params{Param{"id", "-1"}}},
+		{"/user/0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0", false, "/user/:uuid<uuid>", Params{Param{"uuid", "0b1c2d3e-4f50-6172-8394-a5b6c7d8e9f0"}}},
+		{"/user/gopher", false, "/user/:name", Params{Param{"name", "gopher"}}},
+		{"/user/42/posts", false, "/user/:id<int>/posts", Params{Param{"id", "42"}}},
+		{"/user/gopher/posts", true, "", Params{Param{"name", "gopher"}}},
+		{"/post/hello-world-2", false, "/post/:slug<[a-z0-9-]+>", Params{Param{"slug", "hello-world-2"}}},
+		{"/post/Hello", false, "/post/*path", Params{Param{"path", "/Hello"}}},
+		{"/tag/go/12", false, "/tag/:tag<[^/]+>/:page<\\d{1,3}>", Params{Param{"tag", "go"}, Param{"page", "12"}}},
+		{"/tag/go/1234", true, "", Params{Param{"tag", "go"}}},
+		{"/v2/info", false, "/v:major<int>/info", Params{Param{"major", "2"}}},
+		{"/vx/info", true, "", nil},
+	})
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+
+	// the constraints come before the unconstrained param, in the order of
+	// registration
+	var order []string
+	for _, child := range tree.children {
+		if child.path == "user/" {
+			for _, wild := range child.children[len(child.indices):] {
+				order = append(order, wild.wildcard())
+			}
+		}
+	}
+	if want := []string{":id<int>", ":uuid<uuid>", ":name"}; !reflect.DeepEqual(order, want) {
+		t.Errorf("wrong param children order: want %v, got %v", want, order)
+	}
+}
+
+func TestTreeInvalidConstraint(t *testing.T) {
+	routes := [...]string{
+		"/user/:id<int",
+		"/user/:id<>",
+		"/user/:id<int>x",
+		"/user/:id<int>:name",
+		"/user/:id<nosuchtype>",
+		"/user/:id<[a-z>",
+		"/src/*path<int>",
+	}
+	for _, route := range routes {
+		tree := &node{}
+		recv := catchPanic(func() {
+			tree.addRoute(route, nil)
+		})
+		if recv == nil {
+			t.Errorf("no panic while inserting route with invalid constraint '%s'", route)
+		}
+		if tree.priority != 0 || len(tree.children) != 0 {
+			t.Errorf("tree modified while inserting route with invalid constraint '%s'", route)
+		}
+	}
+}
+
+// treeShape describes the structure of the tree below n, independent of the
+// order of the static children, which depends on the order of registration
+func treeShape(n *node) string {
+	children := make([]string, len(n.children))
+	for i, child := range n.children {
+		children[i] = treeShape(child)
+	}
+	sort.Strings(children[:len(n.indices)])
+	return fmt.Sprintf("{%q %d %t %d %d %q %t %v}",
+		n.path, n.nType, n.wildChild, n.priority, n.maxParams, n.fullPath, n.handle != nil, children)
+}
+
+func TestTreeRemove(t *testing.T) {
+	routes := [...]string{
+		"/",
+		"/cmd/:tool/:sub",
+		"/cmd/:tool/",
+		"/cmd/vet",
+		"/src/*filepath",
+		"/src/AUTHORS",
+		"/search/",
+		"/search/:query",
+		"/user_:name",
+		"/user_:name/about",
+		"/user/:id<int>",
+		"/user/:name",
+		"/files/:dir/*filepath",
+		"/doc/go_faq.html",
+		"/doc/go1.html",
+		"/α",
+		"/β",
+	}
+
+	// remove every subset of routes in a few orders and compare with a tree
+	// built from the remaining routes only
+	for i := range routes {
+		for j := range routes {
+			tree := &node{}
+			for _, route := range routes {
+				tree.addRoute(route, fakeHandler(route))
+			}
+
+			removed := map[string]bool{}
+			for k := 0; k < len(routes); k++ {
+				route := routes[(i+k*(j+1))%len(routes)]
+				if removed[route] {
+					continue
+				}
+				if !tree.removeRoute(route) {
+					t.Fatalf("removing route '%s' failed", route)
+				}
+				removed[route] = true
+
+				want := &node{}
+				for _, route := range routes {
+					if !removed[route] {
+						want.addRoute(route, fakeHandler(route))
+					}
+				}
+				if got, want := treeShape(tree), treeShape(want); got != want {
+					t.Fatalf("wrong tree after removing %v:\n got  %s\n want %s", removed, got, want)
+				}
+				checkPriorities(t, tree)
+				checkMaxParams(t, tree)
+			}
+		}
+	}
+
+	tree := &node{}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+	for _, route := range [...]string{
+		"/cmd",
+		"/cmd/:tool",
+		"/cmd/:name/",
+		"/src/*path",
+		"/user/:id",
+		"/user/:id<uint>",
+		"/user/:id<int",
+		"/doc/",
+		"/nope",
+	} {
+		if tree.removeRoute(route) {
+			t.Errorf("removing unregistered route '%s' succeeded", route)
+		}
+	}
+	checkRequests(t, tree, testRequests{
+		{"/cmd/test/", false, "/cmd/:tool/", Params{Param{"tool", "test"}}},
+		{"/src/x", false, "/src/*filepath", Params{Param{"filepath", "/x"}}},
+		{"/user/1", false, "/user/:id<int>", Params{Param{"id", "1"}}},
+	})
+}
+
+func TestTreeClone(t *testing.T) {
+	tree := &node{}
+	tree.addRoute("/cmd/:tool/", fakeHandler("/cmd/:tool/"))
+	tree.addRoute("/src/*filepath", fakeHandler("/src/*filepath"))
+	shape := treeShape(tree)
+
+	clone := tree.clone()
+	clone.addRoute("/cmd/vet", fakeHandler("/cmd/vet"))
+	clone.removeRoute("/src/*filepath")
+
+	if got := treeShape(tree); got != shape {
+		t.Errorf("tree modified through its clone:\n got  %s\n want %s", got, shape)
 	}
-	testRoutes(t, routes)
 }
 
 func TestTreeDupliatePath(t *testing.T) {
@@ -339,12 +583,15 @@ func TestTreeCatchAllConflict(t *testing.T) {
 	testRoutes(t, routes)
 }
 
-func TestTreeCatchAllConflictRoot(t *testing.T) {
-	routes := []testRoute{
-		{"/", false},
-		{"/*filepath", true},
-	}
-	testRoutes(t, routes)
+func TestTreeCatchAllRoot(t *testing.T) {
+	tree := &node{}
+	tree.addRoute("/", fakeHandler("/"))
+	tree.addRoute("/*filepath", fakeHandler("/*filepath"))
+
+	checkRequests(t, tree, testRequests{
+		{"/", false, "/", nil},
+		{"/file", false, "/*filepath", Params{Param{"filepath", "/file"}}},
+	})
 }
 
 func TestTreeDoubleWildcard(t *testing.T) {
@@ -462,6 +709,43 @@ func TestTreeTrailingSlashRedirect(t *testing.T) {
 	}
 }
 
+func TestTreeGetLeafShortcut(t *testing.T) {
+	// getLeaf walks the nodes without alternatives itself, which must find
+	// the same as getStaticLeaf for every path
+	routeSets := [][]string{
+		benchRoutes[:],
+		httprouterBenchRoutes[:],
+		{"/", "/cmd/vet", "/cmd/:tool/:sub", "/cmd/:tool/", "/src/AUTHORS", "/src/:file", "/src/*filepath",
+			"/user_x", "/user_:name", "/id/:id", "/id:id", "/:id", "/*filepath"},
+		{"/hi", "/b/", "/search/:query", "/cmd/:tool/", "/src/*filepath", "/x", "/x/y", "/y/", "/y/z",
+			"/0/:id", "/0/:id/1", "/1/:id/", "/1/:id/2", "/aa", "/a/", "/admin", "/admin/:category",
+			"/admin/:category/:page", "/doc", "/doc/go_faq.html", "/doc/go1.html", "/no/a", "/no/b"},
+		{"/user/:id<int>", "/user/:name/posts", "/files/*path", "/files/:dir/x"},
+		{"/:test"},
+	}
+	segments := regexp.MustCompile(`[:*][^/]+`)
+	for _, routes := range routeSets {
+		tree := &node{}
+		var paths []string
+		for _, route := range routes {
+			tree.addRoute(route, fakeHandler(route))
+
+			path := segments.ReplaceAllString(route, "42")
+			for i := 1; i <= len(path); i++ {
+				paths = append(paths, path[:i], path[:i]+"/", path[:i]+"/x")
+			}
+		}
+
+		for _, path := range paths {
+			leaf, ps, tsr := tree.getLeaf(path, nil)
+			wantLeaf, wantPs, wantTsr := tree.getStaticLeaf(path, nil, "", nil)
+			if leaf != wantLeaf || tsr != wantTsr || (leaf != nil && !reflect.DeepEqual(ps, wantPs)) {
+				t.Errorf("%s: got %v %v %v, want %v %v %v", path, leaf != nil, ps, tsr, wantLeaf != nil, wantPs, wantTsr)
+			}
+		}
+	}
+}
+
 func TestTreeRootTrailingSlashRedirect(t *testing.T) {
 	tree := &node{}
 
@@ -669,22 +953,19 @@ func TestTreeWildcardConflictEx(t *testing.T) {
 		existPath    string
 		existSegPath string
 	}{
-		{"/who/are/foo", "/foo", `/who/are/\*you`, `/\*you`},
-		{"/who/are/foo/", "/foo/", `/who/are/\*you`, `/\*you`},
-		{"/who/are/foo/bar", "/foo/bar", `/who/are/\*you`, `/\*you`},
-		{"/conxxx", "xxx", `/con:tact`, `:tact`},
-		{"/conooo/xxx", "ooo", `/con:tact`, `:tact`},
+		{"/who/are/*me", `\*me`, `/who/are/\*you`, `\*you`},
+		{"/con:name", ":name", `/con:tact`, `:tact`},
+		{"/con:name/xxx", ":name", `/con:tact`, `:tact`},
+		{"/num/:n<int>", ":n<int>", `/num/:id<int>`, `:id<int>`},
 	}
 
 	for _, conflict := range conflicts {
-		// I have to re-create a 'tree', because the 'tree' will be
-		// in an inconsistent state when the loop recovers from the
-		// panic which threw by 'addRoute' function.
 		tree := &node{}
 		routes := [...]string{
 			"/con:tact",
 			"/who/are/*you",
 			"/who/foo/hello",
+			"/num/:id<int>",
 		}
 
 		for _, route := range routes {
@@ -700,3 +981,163 @@ func TestTreeWildcardConflictEx(t *testing.T) {
 		}
 	}
 }
+
+func TestTreeStaticZeroAlloc(t *testing.T) {
+	tree := &node{}
+	for _, route := range benchRoutes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		tree.getValue("/user/new")
+		tree.getValue("/doc/go_faq.html")
+	})
+	if allocs != 0 {
+		t.Errorf("static lookup allocated %v times", allocs)
+	}
+}
+
+var benchRoutes = [...]string{
+	"/",
+	"/cmd/:tool/:sub",
+	"/cmd/:tool/",
+	"/src/*filepath",
+	"/search/",
+	"/search/:query",
+	"/user_:name",
+	"/user_:name/about",
+	"/files/:dir/*filepath",
+	"/doc/",
+	"/doc/go_faq.html",
+	"/doc/go1.html",
+	"/info/:user/public",
+	"/info/:user/project/:project",
+	"/user/new",
+	"/user/:user",
+	"/user/:user/settings",
+}
+
+func benchmarkTreeGetValue(b *testing.B, paths ...string) {
+	tree := &node{}
+	for _, route := range benchRoutes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			tree.getValue(path)
+		}
+	}
+}
+
+func BenchmarkTreeStatic(b *testing.B) {
+	benchmarkTreeGetValue(b, "/doc/go_faq.html", "/search/", "/user/new")
+}
+
+func BenchmarkTreeParam(b *testing.B) {
+	benchmarkTreeGetValue(b, "/cmd/test/3", "/info/gordon/project/go")
+}
+
+func BenchmarkTreeBacktrack(b *testing.B) {
+	benchmarkTreeGetValue(b, "/user/newer/settings", "/user_gopher/about")
+}
+
+func BenchmarkTreeCatchAll(b *testing.B) {
+	benchmarkTreeGetValue(b, "/src/some/file.png", "/files/js/inc/framework.js")
+}
+
+// The routes of benchRoutes which the httprouter tree, without static
+// children beside a wildcard child, accepts as well. Looking them up compares
+// this tree with the one of httprouter it is derived from, see the README.
+var httprouterBenchRoutes = [...]string{
+	"/",
+	"/cmd/:tool/:sub",
+	"/cmd/:tool/",
+	"/src/*filepath",
+	"/search/",
+	"/search/:query",
+	"/user_:name",
+	"/user_:name/about",
+	"/files/:dir/*filepath",
+	"/doc/",
+	"/doc/go_faq.html",
+	"/doc/go1.html",
+	"/info/:user/public",
+	"/info/:user/project/:project",
+}
+
+func benchmarkHTTPRouterTreeGetValue(b *testing.B, paths ...string) {
+	tree := &node{}
+	for _, route := range httprouterBenchRoutes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			tree.getValue(path)
+		}
+	}
+}
+
+func BenchmarkTreeHTTPRouterStatic(b *testing.B) {
+	benchmarkHTTPRouterTreeGetValue(b, "/doc/go_faq.html", "/search/", "/doc/go1.html")
+}
+
+func BenchmarkTreeHTTPRouterParam(b *testing.B) {
+	benchmarkHTTPRouterTreeGetValue(b, "/cmd/test/3", "/info/gordon/project/go", "/search/gopher")
+}
+
+func BenchmarkTreeHTTPRouterCatchAll(b *testing.B) {
+	benchmarkHTTPRouterTreeGetValue(b, "/src/some/file.png", "/files/js/inc/framework.js")
+}
+
+func BenchmarkTreeHTTPRouterTSR(b *testing.B) {
+	benchmarkHTTPRouterTreeGetValue(b, "/doc", "/cmd/test", "/user_gopher/about/")
+}
+
+func BenchmarkTreeFindCaseInsensitivePath(b *testing.B) {
+	tree := &node{}
+	for _, route := range benchRoutes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		tree.findCaseInsensitivePath("/DOC/GO_FAQ.HTML", true)
+		tree.findCaseInsensitivePath("/User/Gopher/Settings/", true)
+	}
+}
+
+func TestTreeFailedAddRouteUnchanged(t *testing.T) {
+	tree := &node{}
+	routes := [...]string{
+		"/con:tact",
+		"/who/are/*you",
+		"/who/foo/hello",
+		"/num/:id<int>/x",
+	}
+	for _, route := range routes {
+		tree.addRoute(route, fakeHandler(route))
+	}
+
+	for _, route := range [...]string{"/con:name", "/who/are/*me", "/num/:n<int>/x", "/num/:id<int>/x", "/who/foo/hello"} {
+		if recv := catchPanic(func() {
+			tree.addRoute(route, fakeHandler(route))
+		}); recv == nil {
+			t.Fatalf("no panic for conflicting route '%s'", route)
+		}
+	}
+
+	checkPriorities(t, tree)
+	checkMaxParams(t, tree)
+	checkRequests(t, tree, testRequests{
+		{"/contact", false, "/con:tact", Params{Param{"tact", "tact"}}},
+		{"/who/are/foo", false, "/who/are/*you", Params{Param{"you", "/foo"}}},
+		{"/num/42/x", false, "/num/:id<int>/x", Params{Param{"id", "42"}}},
+	})
+}
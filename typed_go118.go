@@ -0,0 +1,87 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package mrouter
+
+import (
+	"net/http"
+	"reflect"
+)
+
+// TypedHandle is a request handle receiving the values of the parameters of
+// its route decoded into the struct P, see HandleT.
+type TypedHandle[P any] func(http.ResponseWriter, *http.Request, P) error
+
+// HandleT registers a typed request handle with the given path and method.
+// The values of the parameters are decoded into a P with Params.Bind for each
+// request, which fails with a *BindError if they can't be, e.g.:
+//
+//	type postParams struct {
+//		User string `param:"user"`
+//		ID   int    `param:"id"`
+//	}
+//
+//	mrouter.GetT(router, "/user/:user/posts/:id", func(w http.ResponseWriter, r *http.Request, p postParams) error {
+//		...
+//	})
+//
+// P must be a struct whose fields bind exactly the parameters of the path,
+// or HandleT panics, so that a misspelt name is caught at registration
+// instead of silently yielding an empty value. The parameters of hosts and
+// SaveMatchedRoutePath are not bound.
+func HandleT[P any](r *Router, method, path string, handle TypedHandle[P]) *Route {
+	if err := checkBindParams(reflect.TypeOf((*P)(nil)).Elem(), path); err != nil {
+		panic(err.Error())
+	}
+	if handle == nil {
+		panic("handle must not be nil for path '" + path + "'")
+	}
+
+	return r.Handle(method, path, func(w http.ResponseWriter, req *http.Request, ps Params) error {
+		var p P
+		if err := ps.Bind(&p); err != nil {
+			return err
+		}
+		return handle(w, req, p)
+	})
+}
+
+// GetT is a shortcut for HandleT(router, "GET", path, handle)
+func GetT[P any](r *Router, path string, handle TypedHandle[P]) *Route {
+	return HandleT(r, "GET", path, handle)
+}
+
+// HeadT is a shortcut for HandleT(router, "HEAD", path, handle)
+func HeadT[P any](r *Router, path string, handle TypedHandle[P]) *Route {
+	return HandleT(r, "HEAD", path, handle)
+}
+
+// OptionsT is a shortcut for HandleT(router, "OPTIONS", path, handle)
+func OptionsT[P any](r *Router, path string, handle TypedHandle[P]) *Route {
+	return HandleT(r, "OPTIONS", path, handle)
+}
+
+// PostT is a shortcut for HandleT(router, "POST", path, handle)
+func PostT[P any](r *Router, path string, handle TypedHandle[P]) *Route {
+	return HandleT(r, "POST", path, handle)
+}
+
+// PutT is a shortcut for HandleT(router, "PUT", path, handle)
+func PutT[P any](r *Router, path string, handle TypedHandle[P]) *Route {
+	return HandleT(r, "PUT", path, handle)
+}
+
+// PatchT is a shortcut for HandleT(router, "PATCH", path, handle)
+func PatchT[P any](r *Router, path string, handle TypedHandle[P]) *Route {
+	return HandleT(r, "PATCH", path, handle)
+}
+
+// DeleteT is a shortcut for HandleT(router, "DELETE", path, handle)
+func DeleteT[P any](r *Router, path string, handle TypedHandle[P]) *Route {
+	return HandleT(r, "DELETE", path, handle)
+}
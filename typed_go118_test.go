@@ -0,0 +1,84 @@
+// Copyright 2017 Prasanna V. Loganathar.
+// All rights reserved.
+// Use of this source code is governed by a BSD-style license that can be found
+// in the LICENSE file.
+
+//go:build go1.18
+// +build go1.18
+
+package mrouter
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type postParams struct {
+	User string `param:"user"`
+	ID   int    `param:"id"`
+	File string `param:"filepath"`
+}
+
+func TestHandleT(t *testing.T) {
+	var got postParams
+	handle := func(_ http.ResponseWriter, _ *http.Request, p postParams) error {
+		got = p
+		return nil
+	}
+
+	router := New()
+	router.SaveMatchedRoutePath = true
+	GetT(router, "/user/:user/posts/:id<int>/files/*filepath", handle)
+	PostT(router, "/u/:user/p/:id/f/*filepath", handle)
+
+	r, _ := http.NewRequest("GET", "/user/gopher/posts/42/files/a/b", nil)
+	if err := router.ServeHTTP(new(mockResponseWriter), r); err != nil {
+		t.Fatal(err)
+	}
+	if want := (postParams{"gopher", 42, "/a/b"}); got != want {
+		t.Errorf("wrong params: want %+v, got %+v", want, got)
+	}
+
+	// values that can't be decoded are bad requests
+	got = postParams{}
+	r, _ = http.NewRequest("POST", "/u/gopher/p/new/f/a", nil)
+	err := router.ServeHTTP(new(mockResponseWriter), r)
+	if e, ok := err.(*BindError); !ok || e.Code() != http.StatusBadRequest {
+		t.Errorf("want a *BindError, got %v", err)
+	}
+	if got != (postParams{}) {
+		t.Errorf("handle called with invalid params: %+v", got)
+	}
+}
+
+func TestHandleTMismatch(t *testing.T) {
+	handle := func(_ http.ResponseWriter, _ *http.Request, _ postParams) error { return nil }
+
+	tests := []struct {
+		path, panic string
+	}{
+		{"/user/:user/posts/:ident/files/*filepath", "binds parameter id, which is not in path"},
+		{"/user/:user/posts/:id/files/:filepath/:extra", "parameter extra of path"},
+		{"/user/:user/posts/:id", "binds parameter filepath"},
+	}
+	for _, test := range tests {
+		recv := catchPanic(func() {
+			GetT(New(), test.path, handle)
+		})
+		if msg, _ := recv.(string); !strings.Contains(msg, test.panic) {
+			t.Errorf("wrong panic for %s: want %q, got %v", test.path, test.panic, recv)
+		}
+	}
+
+	if recv := catchPanic(func() {
+		GetT(New(), "/user/:id", func(_ http.ResponseWriter, _ *http.Request, _ int) error { return nil })
+	}); recv == nil {
+		t.Error("no panic for params of a non-struct type")
+	}
+	if recv := catchPanic(func() {
+		GetT[struct{}](New(), "/static", nil)
+	}); recv == nil {
+		t.Error("no panic for nil handle")
+	}
+}